@@ -23,17 +23,19 @@ var buildCmd = &cobra.Command{
 	Short: "Builds a package",
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		watch, _ := cmd.Flags().GetBool("watch")
+		serve, _ := cmd.Flags().GetString("serve")
+		if !watch && serve == "" && forwardToDaemon() {
+			return
+		}
+
 		_, pkg, _, _ := getTarget(args, false)
 		if pkg == nil {
 			log.Fatal("build needs a package")
 		}
 		opts, localCache := getBuildOpts(cmd)
 
-		var (
-			watch, _ = cmd.Flags().GetBool("watch")
-			save, _  = cmd.Flags().GetString("save")
-			serve, _ = cmd.Flags().GetString("serve")
-		)
+		save, _ := cmd.Flags().GetString("save")
 		if watch {
 			err := turbocache.Build(pkg, opts...)
 			if err != nil {
@@ -54,6 +56,7 @@ var buildCmd = &cobra.Command{
 					_, pkg, _, _ := getTarget(args, false)
 					err := turbocache.Build(pkg, opts...)
 					if err == nil {
+						reportBuildOutputs(localCache, pkg)
 						cancel()
 						ctx, cancel = context.WithCancel(context.Background())
 						if save != "" {
@@ -84,6 +87,20 @@ var buildCmd = &cobra.Command{
 	},
 }
 
+// reportBuildOutputs tells the user which files a package rebuilt while watching its sources produced
+func reportBuildOutputs(localCache *turbocache.FilesystemCache, pkg *turbocache.Package) {
+	br, exists := localCache.Location(pkg)
+	if !exists {
+		return
+	}
+	files, err := turbocache.ListArtifactFiles(br)
+	if err != nil {
+		log.WithError(err).Warn("cannot list build outputs")
+		return
+	}
+	log.WithField("package", pkg.FullName()).WithField("files", files).WithField("result", br).Info("build result updated")
+}
+
 func serveBuildResult(ctx context.Context, addr string, localCache *turbocache.FilesystemCache, pkg *turbocache.Package) {
 	br, exists := localCache.Location(pkg)
 	if !exists {
@@ -170,8 +187,11 @@ func addBuildFlags(cmd *cobra.Command) {
 	cmd.Flags().Bool("dont-test", false, "Disable all package-level tests (defaults to false)")
 	cmd.Flags().Bool("dont-compress", false, "Disable compression of build artifacts (defaults to false)")
 	cmd.Flags().Bool("jailed-execution", false, "Run all build commands using runc (defaults to false)")
+	cmd.Flags().Bool("sandboxed-execution", false, "Run all build commands in a namespace-based sandbox, Linux only (defaults to false)")
+	cmd.Flags().String("cgroup-parent", "", "Run each package build in its own cgroup below this cgroup v2 path and report its resource usage, Linux only")
+	cmd.Flags().StringArray("worker", nil, "Dispatch package builds to a worker (see turbocache worker), e.g. --worker localhost:7080. Can be given multiple times.")
 	cmd.Flags().UintP("max-concurrent-tasks", "j", uint(runtime.NumCPU()), "Limit the number of max concurrent build tasks - set to 0 to disable the limit")
-	cmd.Flags().String("coverage-output-path", "", "Output path where test coverage file will be copied after running tests")
+	cmd.Flags().String("coverage-output-path", "", "Output path where the test coverage files of the packages, and the merged lcov.info and cobertura.xml reports are written after running tests")
 	cmd.Flags().StringToString("docker-build-options", nil, "Options passed to all 'docker build' commands")
 	cmd.Flags().String("report", "", "Generate a HTML report after the build has finished. (e.g. --report myreport.html)")
 	cmd.Flags().String("report-segment", os.Getenv("TURBOCACHE_SEGMENT_KEY"), "Report build events to segment using the segment key (defaults to $TURBOCACHE_SEGMENT_KEY)")
@@ -289,6 +309,24 @@ func getBuildOpts(cmd *cobra.Command) ([]turbocache.BuildOption, *turbocache.Fil
 		log.Fatal(err)
 	}
 
+	sandboxedExecution, err := cmd.Flags().GetBool("sandboxed-execution")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cgroupParent, err := cmd.Flags().GetString("cgroup-parent")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var workers *turbocache.WorkerPool
+	if addrs, _ := cmd.Flags().GetStringArray("worker"); len(addrs) > 0 {
+		workers, err = turbocache.NewWorkerPool(addrs)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	dontCompress, err := cmd.Flags().GetBool("dont-compress")
 	if err != nil {
 		log.Fatal(err)
@@ -305,6 +343,9 @@ func getBuildOpts(cmd *cobra.Command) ([]turbocache.BuildOption, *turbocache.Fil
 		turbocache.WithCoverageOutputPath(coverageOutputPath),
 		turbocache.WithDockerBuildOptions(&dockerBuildOptions),
 		turbocache.WithJailedExecution(jailedExecution),
+		turbocache.WithSandboxedExecution(sandboxedExecution),
+		turbocache.WithCgroupParent(cgroupParent),
+		turbocache.WithWorkers(workers),
 		turbocache.WithCompressionDisabled(dontCompress),
 	}, localCache
 }
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manages the caches turbocache maintains besides the build cache",
+	Args:  cobra.NoArgs,
+}
+
+// cacheGCCmd represents the cache gc command
+var cacheGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Trims the Go build and module caches turbocache shares among the Go packages of the workspace",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ws, err := getWorkspace()
+		if err != nil {
+			log.Fatal(err)
+		}
+		maxAge, _ := cmd.Flags().GetDuration("max-age")
+		modcache, _ := cmd.Flags().GetBool("modcache")
+
+		caches := ws.GoCaches()
+		files, size, err := caches.Trim(maxAge)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("removed %d entries (%d MiB) from the Go build cache %s\n", files, size/(1024*1024), caches.Build)
+
+		if modcache {
+			err = caches.CleanModuleCache()
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("removed the Go module cache %s\n", caches.Module)
+		}
+	},
+}
+
+func init() {
+	cacheGCCmd.Flags().Duration("max-age", 5*24*time.Hour, "remove build cache entries which have not been used for this long")
+	cacheGCCmd.Flags().Bool("modcache", false, "remove the module cache, too")
+	cacheCmd.AddCommand(cacheGCCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
@@ -34,6 +34,10 @@ var collectCmd = &cobra.Command{
 	Args:      cobra.MatchAll(cobra.OnlyValidArgs, cobra.MaximumNArgs(1)),
 	ValidArgs: []string{"components", "packages", "scripts", "scripts", "files"},
 	Run: func(cmd *cobra.Command, args []string) {
+		if forwardToDaemon() {
+			return
+		}
+
 		workspace, err := getWorkspace()
 		if err != nil {
 			log.Fatal(err)
@@ -159,7 +163,7 @@ var collectCmd = &cobra.Command{
 				}
 				decs[i].Sources.Exclude = v.Sources.Exclude
 				decs[i].Sources.Include = v.Sources.Include
-				for _, t := range []turbocache.PackageType{turbocache.DockerPackage, turbocache.GenericPackage, turbocache.GoPackage, turbocache.YarnPackage} {
+				for _, t := range []turbocache.PackageType{turbocache.DockerPackage, turbocache.GenericPackage, turbocache.GoPackage, turbocache.RustPackage, turbocache.PythonPackage, turbocache.YarnPackage} {
 					vntcfg, ok := v.Config(t)
 					if !ok {
 						continue
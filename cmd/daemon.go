@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gookit/color"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/khulnasoft/turbocache/pkg/turbocache"
+)
+
+// EnvvarDaemonSocket configures the unix socket the daemon listens on and the CLI connects to
+const EnvvarDaemonSocket = "TURBOCACHE_DAEMON_SOCKET"
+
+// daemonWorkspaces is set when running as daemon, in which case getWorkspace serves the workspaces kept in memory
+var daemonWorkspaces *turbocache.LiveWorkspaces
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keeps the workspace in memory and serves build, collect and describe requests from the CLI",
+	Long: `Keeps the workspace in memory and serves build, collect and describe requests from the CLI.
+
+While the daemon runs, "turbocache build", "turbocache collect" and "turbocache describe" are executed by the daemon,
+which saves loading the workspace on every invocation. The daemon watches the workspace and updates the package versions
+as files change. It executes one request at a time using the environment of the CLI invocation.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, err := filepath.Abs(workspace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		daemonWorkspaces = &turbocache.LiveWorkspaces{Path: root}
+
+		// warm up using the default arguments
+		_, err = daemonWorkspaces.Get(root, nil, "", os.Getenv("TURBOCACHE_PROVENANCE_KEYPATH"))
+		if err != nil {
+			log.WithError(err).Warn("cannot load workspace")
+		}
+
+		sock := daemonSocket(root)
+		if _, err := os.Stat(sock); err == nil {
+			if _, err := net.Dial("unix", sock); err == nil {
+				log.Fatalf("a daemon is already listening on %s", sock)
+			}
+			// the socket is a leftover of a daemon that is gone
+			os.Remove(sock)
+		}
+		l, err := net.Listen("unix", sock)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(sock)
+		go func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			<-sigs
+			l.Close()
+		}()
+
+		d := &daemon{}
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v1/run", d.handleRun)
+
+		log.WithField("socket", sock).WithField("workspace", root).Info("daemon is ready")
+		err = http.Serve(l, mux)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+}
+
+// daemonSocket returns the unix socket location of the daemon serving the workspace
+func daemonSocket(root string) string {
+	if sock := os.Getenv(EnvvarDaemonSocket); sock != "" {
+		return sock
+	}
+	hash := sha1.Sum([]byte(root))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("turbocache-%x.sock", hash[:4]))
+}
+
+// daemonRequest asks the daemon to run a turbocache command
+type daemonRequest struct {
+	Args []string `json:"args"`
+	Dir  string   `json:"dir"`
+	Env  []string `json:"env"`
+}
+
+// daemonEvent is streamed by the daemon while it runs a command
+type daemonEvent struct {
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	Exit   *int   `json:"exit,omitempty"`
+}
+
+// daemonExit is raised by log.Fatal while the daemon runs a command
+type daemonExit int
+
+type daemon struct {
+	mu sync.Mutex
+}
+
+func (d *daemon) handleRun(rw http.ResponseWriter, req *http.Request) {
+	var dreq daemonRequest
+	err := json.NewDecoder(req.Body).Decode(&dreq)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	var (
+		enc     = json.NewEncoder(rw)
+		flusher = rw.(http.Flusher)
+		sendMu  sync.Mutex
+	)
+	send := func(evt daemonEvent) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		//nolint:errcheck
+		enc.Encode(evt)
+		flusher.Flush()
+	}
+
+	// commands modify process-wide state (flags, working directory, environment, stdout) - hence we run one at a time
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	code := d.run(dreq, send)
+	send(daemonEvent{Exit: &code})
+}
+
+// run executes the command of the request as if turbocache was invoked from the CLI
+func (d *daemon) run(dreq daemonRequest, send func(daemonEvent)) (code int) {
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		send(daemonEvent{Stderr: []byte(err.Error() + "\n")})
+		return 1
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		send(daemonEvent{Stderr: []byte(err.Error() + "\n")})
+		return 1
+	}
+	var wg sync.WaitGroup
+	forward := func(r io.Reader, isErr bool) {
+		defer wg.Done()
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				if isErr {
+					send(daemonEvent{Stderr: data})
+				} else {
+					send(daemonEvent{Stdout: data})
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	wg.Add(2)
+	go forward(stdoutR, false)
+	go forward(stderrR, true)
+
+	var (
+		origStdout = os.Stdout
+		origStderr = os.Stderr
+		origEnv    = os.Environ()
+		origLevel  = log.GetLevel()
+		origWd, _  = os.Getwd()
+		logger     = log.StandardLogger()
+	)
+	os.Stdout, os.Stderr = stdoutW, stderrW
+	color.SetOutput(stdoutW)
+	log.SetOutput(stderrW)
+	logger.ExitFunc = func(code int) { panic(daemonExit(code)) }
+	setEnvironment(dreq.Env)
+	if dreq.Dir != "" {
+		//nolint:errcheck
+		os.Chdir(dreq.Dir)
+	}
+	defer func() {
+		os.Stdout, os.Stderr = origStdout, origStderr
+		color.SetOutput(origStdout)
+		log.SetOutput(origStderr)
+		log.SetLevel(origLevel)
+		logger.ExitFunc = os.Exit
+		setEnvironment(origEnv)
+		//nolint:errcheck
+		os.Chdir(origWd)
+
+		stdoutW.Close()
+		stderrW.Close()
+		wg.Wait()
+		stdoutR.Close()
+		stderrR.Close()
+	}()
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if exit, ok := r.(daemonExit); ok {
+			code = int(exit)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "turbocache daemon: %v\n", r)
+		code = 2
+	}()
+
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(dreq.Args)
+	err = rootCmd.Execute()
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func setEnvironment(env []string) {
+	os.Clearenv()
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		os.Setenv(k, v)
+	}
+}
+
+// resetFlags resets all flags of the command and its subcommands to their defaults
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		switch val := f.Value.(type) {
+		case pflag.SliceValue:
+			var def []string
+			if d := strings.Trim(f.DefValue, "[]"); d != "" {
+				def = strings.Split(d, ",")
+			}
+			//nolint:errcheck
+			val.Replace(def)
+		default:
+			if f.Value.Type() == "stringToString" {
+				// stringToString merges all values once set, hence needs a fresh value
+				fs := pflag.NewFlagSet("", pflag.ContinueOnError)
+				fs.StringToString(f.Name, nil, "")
+				f.Value = fs.Lookup(f.Name).Value
+				break
+			}
+			//nolint:errcheck
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, c := range cmd.Commands() {
+		resetFlags(c)
+	}
+}
+
+// forwardToDaemon runs the current invocation in the daemon serving the workspace.
+// Returns false if there is no such daemon, in which case the caller runs the command itself.
+func forwardToDaemon() bool {
+	if daemonWorkspaces != nil {
+		// we are the daemon
+		return false
+	}
+
+	root, err := filepath.Abs(workspace)
+	if err != nil {
+		return false
+	}
+	sock := daemonSocket(root)
+	if _, err := os.Stat(sock); err != nil {
+		return false
+	}
+
+	wd, _ := os.Getwd()
+	fc, err := json.Marshal(daemonRequest{
+		Args: append(os.Args[1:], "--workspace="+root),
+		Dir:  wd,
+		Env:  os.Environ(),
+	})
+	if err != nil {
+		return false
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+	resp, err := client.Post("http://daemon/v1/run", "application/json", strings.NewReader(string(fc)))
+	if err != nil {
+		log.WithError(err).WithField("socket", sock).Debug("cannot reach daemon - running without")
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		log.Fatalf("daemon cannot run command: %s", strings.TrimSpace(string(msg)))
+	}
+	log.WithField("socket", sock).Debug("running in daemon")
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var evt daemonEvent
+		err := dec.Decode(&evt)
+		if errors.Is(err, io.EOF) {
+			log.Fatal("daemon did not report an exit code")
+		}
+		if err != nil {
+			log.WithError(err).Fatal("lost connection to daemon")
+		}
+		if len(evt.Stdout) > 0 {
+			//nolint:errcheck
+			os.Stdout.Write(evt.Stdout)
+		}
+		if len(evt.Stderr) > 0 {
+			//nolint:errcheck
+			os.Stderr.Write(evt.Stderr)
+		}
+		if evt.Exit != nil {
+			if *evt.Exit != 0 {
+				os.Exit(*evt.Exit)
+			}
+			return true
+		}
+	}
+}
@@ -60,6 +60,10 @@ func printDepTree(pkg *turbocache.Package, indent int) {
 		tpe = "generic"
 	case turbocache.GoPackage:
 		tpe = "go"
+	case turbocache.RustPackage:
+		tpe = "rust"
+	case turbocache.PythonPackage:
+		tpe = "python"
 	case turbocache.YarnPackage:
 		tpe = "yarn"
 	}
@@ -19,6 +19,10 @@ var describeCmd = &cobra.Command{
 	Short: "Describes a single component or package",
 	Args:  cobra.MaximumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 && forwardToDaemon() {
+			return
+		}
+
 		if len(args) == 2 {
 			cmdname := args[0]
 			var subcmd *cobra.Command
@@ -87,6 +91,12 @@ func getTarget(args []string, findScript bool) (comp *turbocache.Component, pkg
 		}
 
 		pkg, exists = workspace.Packages[target]
+		if owner, output, isOutput := strings.Cut(target, "#"); !exists && isOutput {
+			if p, ok := workspace.Packages[owner]; ok {
+				pkg = p.NamedOutput(output)
+				exists = pkg != nil
+			}
+		}
 		if !exists {
 			log.Fatalf("package \"%s\" does not exist", target)
 			return
@@ -158,6 +168,7 @@ type packageDescription struct {
 	Type               string                       `json:"type" yaml:"type"`
 	Manifest           map[string]string            `json:"manifest" yaml:"manifest"`
 	ArgDeps            []string                     `json:"argdeps,omitempty" yaml:"argdeps,omitempty"`
+	EnvDeps            []string                     `json:"envdeps,omitempty" yaml:"envdeps,omitempty"`
 	Dependencies       []packageMetadataDescription `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
 	Layout             map[string]string            `json:"layout,omitempty" yaml:"layout,omitempty"`
 	Config             configDescription            `json:"config,omitempty" yaml:"config,omitempty"`
@@ -165,6 +176,8 @@ type packageDescription struct {
 	Definition         string                       `json:"definition,omitempty"`
 	FilesystemSafeName string                       `json:"fsSafeName,omitempty"`
 	Sources            []string                     `json:"sources,omitempty"`
+	Outputs            []string                     `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	NamedOutputs       map[string][]string          `json:"namedOutputs,omitempty" yaml:"namedOutputs,omitempty"`
 }
 
 func newPackageDesription(pkg *turbocache.Package) packageDescription {
@@ -193,6 +206,7 @@ func newPackageDesription(pkg *turbocache.Package) packageDescription {
 		Metadata:           newMetadataDescription(pkg),
 		Type:               string(pkg.Type),
 		ArgDeps:            pkg.ArgumentDependencies,
+		EnvDeps:            pkg.EnvDependencyValues(),
 		Dependencies:       deps,
 		Layout:             layout,
 		Env:                pkg.Environment,
@@ -201,6 +215,8 @@ func newPackageDesription(pkg *turbocache.Package) packageDescription {
 		Definition:         string(pkg.Definition),
 		FilesystemSafeName: pkg.FilesystemSafeName(),
 		Sources:            pkg.Sources,
+		Outputs:            pkg.Outputs,
+		NamedOutputs:       pkg.NamedOutputs,
 	}
 }
 
@@ -215,6 +231,8 @@ func newConfigDescription(tpe turbocache.PackageType, c turbocache.PackageConfig
 		cfg["dockerfile"] = c.Dockerfile
 		cfg["image"] = c.Image
 		cfg["squash"] = c.Squash
+		cfg["backend"] = c.Backend
+		cfg["platforms"] = c.Platforms
 	case turbocache.GenericPackage:
 		c := c.(turbocache.GenericPkgConfig)
 		cfg["commands"] = c.Commands
@@ -229,10 +247,29 @@ func newConfigDescription(tpe turbocache.PackageType, c turbocache.PackageConfig
 		cfg["generate"] = c.Generate
 		cfg["packaging"] = c.Packaging
 		cfg["lintCommand"] = c.LintCommand
+		cfg["platforms"] = c.Platforms
+		cfg["workspaceModules"] = c.WorkspaceModules
+		cfg["minCoverage"] = c.MinCoverage
+	case turbocache.RustPackage:
+		c := c.(turbocache.RustPkgConfig)
+		cfg["dontTest"] = c.DontTest
+		cfg["dontLint"] = c.DontLint
+		cfg["features"] = c.Features
+		cfg["packaging"] = c.Packaging
+		cfg["profile"] = c.Profile
+	case turbocache.PythonPackage:
+		c := c.(turbocache.PythonPkgConfig)
+		cfg["buildRequires"] = c.BuildRequires
+		cfg["dontTest"] = c.DontTest
+		cfg["dontLint"] = c.DontLint
+		cfg["linter"] = c.Linter
 	case turbocache.YarnPackage:
 		c := c.(turbocache.YarnPkgConfig)
 		cfg["dontTest"] = c.DontTest
 		cfg["packaging"] = c.Packaging
+		cfg["packageManager"] = c.PackageManager
+		cfg["minCoverage"] = c.MinCoverage
+		cfg["coverageDir"] = c.CoverageDir
 		cfg["tsConfig"] = c.TSConfig
 		cfg["yarnLock"] = c.YarnLock
 		cfg["commands"] = map[string][]string{
@@ -240,6 +277,12 @@ func newConfigDescription(tpe turbocache.PackageType, c turbocache.PackageConfig
 			"install": c.Commands.Install,
 			"test":    c.Commands.Test,
 		}
+	default:
+		if c, ok := c.(turbocache.PluginPkgConfig); ok {
+			for k, v := range c {
+				cfg[k] = v
+			}
+		}
 	}
 	return cfg
 }
@@ -261,6 +304,12 @@ Version Relevant Arguments:
 {{"\t"}}{{ $v -}}
 {{ end -}}
 {{ end }}
+{{ if .EnvDeps -}}
+Version Relevant Environment Variables:
+{{- range $k, $v := .EnvDeps }}
+{{"\t"}}{{ $v -}}
+{{ end -}}
+{{ end }}
 {{ if .Dependencies -}}
 Dependencies:
 {{- range $k, $v := .Dependencies }}
@@ -277,6 +326,18 @@ Sources:
 {{"\t"}}{{ $k }}{{"\t"}}{{ $v -}}
 {{ end -}}
 {{ end }}
+{{ if .Outputs -}}
+Outputs:
+{{- range $k, $v := .Outputs }}
+{{"\t"}}{{ $v -}}
+{{ end -}}
+{{ end }}
+{{ if .NamedOutputs -}}
+Named Outputs:
+{{- range $k, $v := .NamedOutputs }}
+{{"\t"}}{{ $.Metadata.FullName }}#{{ $k }}{{"\t"}}{{ $v -}}
+{{ end -}}
+{{ end }}
 `
 	}
 
@@ -18,11 +18,15 @@ var (
 	packageTypeDetectionFiles = map[turbocache.PackageType][]string{
 		turbocache.DockerPackage: dockerfileCandidates,
 		turbocache.GoPackage:     {"go.mod", "go.sum"},
+		turbocache.RustPackage:   {"Cargo.toml", "Cargo.lock"},
+		turbocache.PythonPackage: {"pyproject.toml", "setup.py"},
 		turbocache.YarnPackage:   {"package.json", "yarn.lock"},
 	}
 	initPackageGenerator = map[turbocache.PackageType]func(name string) ([]byte, error){
 		turbocache.DockerPackage:  initDockerPackage,
 		turbocache.GoPackage:      initGoPackage,
+		turbocache.RustPackage:    initRustPackage,
+		turbocache.PythonPackage:  initPythonPackage,
 		turbocache.YarnPackage:    initYarnPackage,
 		turbocache.GenericPackage: initGenericPackage,
 	}
@@ -33,7 +37,7 @@ var initCmd = &cobra.Command{
 	Use:       "init <name>",
 	Short:     "Initializes a new turbocache package (and component if need be) in the current directory",
 	Args:      cobra.ExactArgs(1),
-	ValidArgs: []string{"go", "yarn", "docker", "generic"},
+	ValidArgs: []string{"go", "rust", "python", "yarn", "docker", "generic"},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var tpe turbocache.PackageType
 		if tper, _ := cmd.Flags().GetString("type"); tper != "" {
@@ -128,6 +132,40 @@ config:
 `, name)), nil
 }
 
+func initRustPackage(name string) ([]byte, error) {
+	return []byte(fmt.Sprintf(`name: %s
+type: rust
+srcs:
+  - Cargo.toml
+  - Cargo.lock
+  - "src/**/*.rs"
+config:
+  packaging: bin
+`, name)), nil
+}
+
+func initPythonPackage(name string) ([]byte, error) {
+	var project string
+	for _, f := range []string{"pyproject.toml", "setup.py"} {
+		if _, err := os.Stat(f); err == nil {
+			project = f
+			break
+		}
+	}
+	if project == "" {
+		return nil, fmt.Errorf("no pyproject.toml or setup.py found")
+	}
+
+	return []byte(fmt.Sprintf(`name: %s
+type: python
+srcs:
+  - %s
+  - "**/*.py"
+config:
+  linter: ruff
+`, name, project)), nil
+}
+
 func initDockerPackage(name string) ([]byte, error) {
 	var dockerfile string
 	for _, f := range dockerfileCandidates {
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/khulnasoft/turbocache/pkg/turbocache"
+)
+
+// plumbingSandboxCmd represents the sandbox command
+var plumbingSandboxCmd = &cobra.Command{
+	Use:   "sandbox <spec>",
+	Short: "Sets up a sandbox and executes commands in it",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := turbocache.RunSandbox(args[0])
+		if err != nil {
+			log.WithError(err).Fatal("sandboxed execution failed")
+		}
+	},
+}
+
+func init() {
+	plumbingCmd.AddCommand(plumbingSandboxCmd)
+}
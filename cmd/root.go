@@ -88,6 +88,8 @@ variables have an effect on turbocache:
             <light_blue>TURBOCACHE_CACHE_DIR</>  Location of the local build cache. The directory does not have to exist yet.
             <light_blue>TURBOCACHE_BUILD_DIR</>  Working location of turbocache (i.e. where the actual builds happen). This location will see heavy I/O
                               which makes it advisable to place this on a fast SSD or in RAM.
+  <light_blue>TURBOCACHE_GO_TOOLCHAIN_CACHE</>  Directory with the layout of a GOPROXY which Go toolchains are resolved from before they are downloaded.
+        <light_blue>TURBOCACHE_GO_CACHE_DIR</>  Directory of the Go build and module caches shared among Go packages. Defaults to a directory in the user cache.
            <light_blue>TURBOCACHE_YARN_MUTEX</>  Configures the mutex flag turbocache will pass to yarn. Defaults to "network".
                               See https://yarnpkg.com/lang/en/docs/cli/#toc-concurrency-and-mutex for possible values.
   <light_blue>TURBOCACHE_DEFAULT_CACHE_LEVEL</>  Sets the default cache level for builds. Defaults to "remote".
@@ -154,6 +156,9 @@ func getWorkspace() (turbocache.Workspace, error) {
 		return turbocache.Workspace{}, err
 	}
 
+	if daemonWorkspaces != nil {
+		return daemonWorkspaces.Get(workspace, args, variant, os.Getenv("TURBOCACHE_PROVENANCE_KEYPATH"))
+	}
 	return turbocache.FindWorkspace(workspace, args, variant, os.Getenv("TURBOCACHE_PROVENANCE_KEYPATH"))
 }
 
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/khulnasoft/turbocache/pkg/turbocache"
+)
+
+// workerCmd represents the worker command
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Runs package builds dispatched by other turbocache builds (see build --worker)",
+	Long: `Runs package builds dispatched by other turbocache builds (see build --worker).
+
+The worker receives the package definition, its sources and the build artifacts of its dependencies,
+builds the package and returns the build artifact and logs. Workers do not authenticate coordinators,
+hence must only listen on trusted networks.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			listen, _   = cmd.Flags().GetString("listen")
+			capacity, _ = cmd.Flags().GetUint("capacity")
+			workdir, _  = cmd.Flags().GetString("workdir")
+		)
+
+		worker, err := turbocache.NewWorker(workdir, int(capacity))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.WithField("address", listen).WithField("capacity", capacity).Info("worker is ready")
+		err = http.ListenAndServe(listen, worker.Handler())
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(workerCmd)
+
+	workerCmd.Flags().String("listen", "localhost:7080", "Address to listen on")
+	workerCmd.Flags().Uint("capacity", uint(runtime.NumCPU()), "Maximum number of package builds to run at once")
+	workerCmd.Flags().String("workdir", filepath.Join(os.TempDir(), "turbocache-worker"), "Directory to run the package builds in")
+}
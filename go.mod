@@ -3,6 +3,7 @@ module github.com/khulnasoft/turbocache
 go 1.23
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/aws/aws-sdk-go-v2 v1.32.3
 	github.com/aws/aws-sdk-go-v2/config v1.28.1
 	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.17.35
@@ -25,9 +26,11 @@ require (
 	github.com/segmentio/textio v1.2.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/cobra v1.8.1
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/mod v0.21.0
 	golang.org/x/sync v0.8.0
+	golang.org/x/sys v0.22.0
 	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da
 	gopkg.in/yaml.v3 v3.0.1
 	sigs.k8s.io/bom v0.1.0
@@ -65,10 +68,8 @@ require (
 	github.com/seccomp/libseccomp-golang v0.10.0 // indirect
 	github.com/segmentio/backo-go v1.0.0 // indirect
 	github.com/shibumi/go-pathspec v1.2.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/xo/terminfo v0.0.0-20210125001918-ca9a967f8778 // indirect
 	golang.org/x/net v0.24.0 // indirect
-	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	sigs.k8s.io/release-utils v0.3.0 // indirect
 )
@@ -2,6 +2,8 @@ package turbocache
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"crypto/rand"
@@ -16,17 +18,21 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/in-toto/in-toto-golang/in_toto"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/mod/modfile"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v3"
+
+	"github.com/khulnasoft/turbocache/pkg/doublestar"
 )
 
 // PkgNotBuiltErr is used when a package's dependency hasn't been built yet
@@ -62,10 +68,15 @@ type buildContext struct {
 
 	mu                 sync.Mutex
 	newlyBuiltPackages map[string]*Package
+	coverage           lineCoverage
 
 	pkgLockCond *sync.Cond
 	pkgLocks    map[string]struct{}
 	buildLimit  *semaphore.Weighted
+
+	cgroupsOnce sync.Once
+	cgroups     *cgroupManager
+	cgroupsErr  error
 }
 
 const (
@@ -75,6 +86,10 @@ const (
 	// EnvvarBuildDir names the environment variable we take the build dir location from
 	EnvvarBuildDir = "TURBOCACHE_BUILD_DIR"
 
+	// EnvvarGoToolchainCache names the environment variable which points to a directory Go toolchains are resolved from
+	// before they're downloaded. The directory has the layout of a GOPROXY, e.g. $GOMODCACHE/cache/download.
+	EnvvarGoToolchainCache = "TURBOCACHE_GO_TOOLCHAIN_CACHE"
+
 	// EnvvarYarnMutex configures the mutex flag turbocache will pass to yarn.
 	// See https://yarnpkg.com/lang/en/docs/cli/#toc-concurrency-and-mutex for possible values.
 	// Defaults to "network".
@@ -87,6 +102,13 @@ const (
 	// dockerMetadataFile is the name of the file we YAML seralize the DockerPkgConfig.Metadata field to
 	// when building Docker images. We use this mechanism to produce the version manifest as part of the Nxpod build.
 	dockerMetadataFile = "metadata.yaml"
+
+	// dockerImageDigestsFile is the name of the file stored in pushed Docker build artifacts
+	// which contains the digest-pinned references (name@sha256:...) of the images we just pushed
+	dockerImageDigestsFile = "imgdigests.txt"
+
+	// dockerBuildxMetadataFile is the name of the file buildx writes the build result metadata to, e.g. the digest of the pushed image
+	dockerBuildxMetadataFile = "buildx-metadata.json"
 )
 
 var (
@@ -104,8 +126,10 @@ func init() {
 // Increment this value if you change any of the build procedures.
 var buildProcessVersions = map[PackageType]int{
 	YarnPackage:    7,
-	GoPackage:      2,
-	DockerPackage:  3,
+	GoPackage:      3,
+	RustPackage:    1,
+	PythonPackage:  1,
+	DockerPackage:  4,
 	GenericPackage: 1,
 }
 
@@ -151,6 +175,7 @@ func newBuildContext(options buildOptions) (ctx *buildContext, err error) {
 		buildDir:           buildDir,
 		buildID:            buildID,
 		newlyBuiltPackages: make(map[string]*Package),
+		coverage:           make(lineCoverage),
 		pkgLockCond:        sync.NewCond(&sync.Mutex{}),
 		pkgLocks:           make(map[string]struct{}),
 		buildLimit:         buildLimit,
@@ -226,6 +251,22 @@ func (c *buildContext) ReleaseConcurrentBuild() {
 	c.buildLimit.Release(1)
 }
 
+// NewPackageCgroup creates the cgroup the package's build commands run in.
+// Returns nil if the package does not need a cgroup, i.e. has no resource limits and no cgroup parent is configured.
+func (c *buildContext) NewPackageCgroup(p *Package) (*packageCgroup, error) {
+	if c.CgroupParent == "" && !p.Resources.IsLimited() {
+		return nil, nil
+	}
+
+	c.cgroupsOnce.Do(func() {
+		c.cgroups, c.cgroupsErr = newCgroupManager(c.CgroupParent)
+	})
+	if c.cgroupsErr != nil {
+		return nil, xerrors.Errorf("cannot limit resources of %s: %w", p.FullName(), c.cgroupsErr)
+	}
+	return c.cgroups.NewPackageCgroup(p, c.buildID)
+}
+
 // RegisterNewlyBuilt adds a new package to the list of packages built in this context
 func (c *buildContext) RegisterNewlyBuilt(p *Package) error {
 	ver, err := p.Version()
@@ -239,6 +280,37 @@ func (c *buildContext) RegisterNewlyBuilt(p *Package) error {
 	return nil
 }
 
+// RegisterLineCoverage adds the line coverage of a package build to the merged coverage report
+func (c *buildContext) RegisterLineCoverage(cov lineCoverage) {
+	c.mu.Lock()
+	c.coverage.merge(cov)
+	c.mu.Unlock()
+}
+
+// buildNamedOutputs builds the named outputs of all newly built packages, so that they are available as cache objects
+// of their own to dependants which need only part of a package.
+func (c *buildContext) buildNamedOutputs() error {
+	var outputs []*Package
+	c.mu.Lock()
+	for _, pkg := range c.newlyBuiltPackages {
+		if pkg.Ephemeral {
+			continue
+		}
+		for _, out := range pkg.namedOutputs {
+			outputs = append(outputs, out)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, out := range outputs {
+		err := out.build(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *buildContext) GetNewPackagesForCache() []*Package {
 	res := make([]*Package, 0, len(c.newlyBuiltPackages))
 	c.mu.Lock()
@@ -265,6 +337,9 @@ type buildOptions struct {
 	CoverageOutputPath     string
 	DockerBuildOptions     *DockerBuildOptions
 	JailedExecution        bool
+	SandboxedExecution     bool
+	CgroupParent           string
+	Workers                *WorkerPool
 
 	context *buildContext
 }
@@ -359,6 +434,30 @@ func WithJailedExecution(jailedExecution bool) BuildOption {
 	}
 }
 
+// WithSandboxedExecution runs all commands in a namespace-based sandbox
+func WithSandboxedExecution(sandboxedExecution bool) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.SandboxedExecution = sandboxedExecution
+		return nil
+	}
+}
+
+// WithCgroupParent runs each package build in its own cgroup below the given cgroup v2 path
+func WithCgroupParent(parent string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.CgroupParent = parent
+		return nil
+	}
+}
+
+// WithWorkers dispatches all package builds to the workers of the pool
+func WithWorkers(pool *WorkerPool) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.Workers = pool
+		return nil
+	}
+}
+
 func WithCompressionDisabled(dontCompress bool) BuildOption {
 	return func(opts *buildOptions) error {
 		opts.DontCompress = dontCompress
@@ -389,10 +488,36 @@ func applyBuildOpts(opts []BuildOption) (buildOptions, error) {
 	if options.LocalCache == nil {
 		return options, xerrors.Errorf("cannot build without local cache. Use WithLocalCache() to configure one")
 	}
+	if options.JailedExecution && options.SandboxedExecution {
+		return options, xerrors.Errorf("jailed and sandboxed execution are exclusive - use one or the other")
+	}
 
 	return options, nil
 }
 
+// buildRequirements returns all packages the build of a package might need. Unlike the transitive dependencies
+// these include the packages named outputs belong to, which need to be built unless the named output is cached.
+func (p *Package) buildRequirements(cached map[*Package]struct{}) []*Package {
+	idx := map[*Package]struct{}{p: {}}
+	queue := append([]*Package{}, p.GetDependencies()...)
+	var res []*Package
+	for len(queue) != 0 {
+		dep := queue[0]
+		queue = queue[1:]
+
+		if _, ok := idx[dep]; ok {
+			continue
+		}
+		idx[dep] = struct{}{}
+		res = append(res, dep)
+		if _, ok := cached[dep]; ok && dep.outputOf != nil {
+			continue
+		}
+		queue = append(queue, dep.GetDependencies()...)
+	}
+	return res
+}
+
 // Build builds the packages in the order they're given. It's the callers responsibility to ensure the dependencies are built
 // in order.
 func Build(pkg *Package, opts ...BuildOption) (err error) {
@@ -410,7 +535,7 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 		return err
 	}
 
-	requirements := pkg.GetTransitiveDependencies()
+	requirements := pkg.buildRequirements(nil)
 	allpkg := append(requirements, pkg)
 
 	pkgsInLocalCache := make(map[*Package]struct{})
@@ -434,6 +559,16 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 		return err
 	}
 
+	// packages which are only needed for named outputs that are cached already are not part of this build
+	cached := make(map[*Package]struct{}, len(pkgsInLocalCache)+len(pkgsInRemoteCache))
+	for p := range pkgsInLocalCache {
+		cached[p] = struct{}{}
+	}
+	for p := range pkgsInRemoteCache {
+		cached[p] = struct{}{}
+	}
+	allpkg = append(pkg.buildRequirements(cached), pkg)
+
 	pkgsWillBeDownloaded := make(map[*Package]struct{})
 	pkg.packagesToDownload(pkgsInLocalCache, pkgsInRemoteCache, pkgsWillBeDownloaded)
 
@@ -460,6 +595,13 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 			continue
 		}
 
+		if ctx.Workers != nil && dep.outputOf == nil {
+			err = checkWorkerBuild(dep)
+			if err != nil {
+				return err
+			}
+		}
+
 		ua, err := FindUnresolvedArguments(dep)
 		if err != nil {
 			return err
@@ -512,8 +654,16 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 	}
 
 	buildErr := pkg.build(ctx)
+	if buildErr == nil {
+		buildErr = ctx.buildNamedOutputs()
+	}
 	cacheErr := ctx.RemoteCache.Upload(ctx.LocalCache, ctx.GetNewPackagesForCache())
 
+	var coverageErr error
+	if ctx.CoverageOutputPath != "" && len(ctx.coverage) > 0 {
+		coverageErr = writeCoverageReports(ctx.CoverageOutputPath, pkg.C.W.Origin, ctx.coverage)
+	}
+
 	if buildErr != nil {
 		// We deliberately swallow the target pacakge build error as that will have already been reported using the reporter.
 		return xerrors.Errorf("build failed")
@@ -521,6 +671,9 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 	if cacheErr != nil {
 		return cacheErr
 	}
+	if coverageErr != nil {
+		return coverageErr
+	}
 
 	return nil
 }
@@ -643,6 +796,15 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 		buildctx.Reporter.PackageBuildFinished(p, pkgRep)
 	}(&err)
 
+	// named outputs only repackage an artifact which is already available locally
+	if buildctx.Workers != nil && p.outputOf == nil {
+		err = buildctx.Workers.build(buildctx, p, pkgRep)
+		if err != nil {
+			return err
+		}
+		return buildctx.RegisterNewlyBuilt(p)
+	}
+
 	pkgdir := p.FilesystemSafeName() + "." + version
 	builddir := filepath.Join(buildctx.BuildDir(), pkgdir)
 	if _, err := os.Stat(builddir); !os.IsNotExist(err) {
@@ -695,17 +857,46 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 	buildctx.LimitConcurrentBuilds()
 	defer buildctx.ReleaseConcurrentBuild()
 
+	cg, err := buildctx.NewPackageCgroup(p)
+	if err != nil {
+		return err
+	}
+	if cg != nil {
+		defer func() {
+			usage, err := cg.Close()
+			if err != nil {
+				log.WithError(err).WithField("package", p.FullName()).Warn("cannot determine resource usage")
+				return
+			}
+			pkgRep.ResourceUsageAvailable = true
+			pkgRep.PeakMemoryBytes = usage.PeakMemoryBytes
+			pkgRep.CPUTime = usage.CPUTime
+		}()
+	}
+
 	switch p.Type {
 	case YarnPackage:
-		bld, err = p.buildYarn(buildctx, builddir, result)
+		if pm := p.JSPackageManager(); pm != JSPackageManagerYarn {
+			bld, err = p.buildJS(buildctx, builddir, result, pm)
+		} else {
+			bld, err = p.buildYarn(buildctx, builddir, result)
+		}
 	case GoPackage:
 		bld, err = p.buildGo(buildctx, builddir, result)
+	case RustPackage:
+		bld, err = p.buildRust(buildctx, builddir, result)
+	case PythonPackage:
+		bld, err = p.buildPython(buildctx, builddir, result)
 	case DockerPackage:
 		bld, err = p.buildDocker(buildctx, builddir, result)
 	case GenericPackage:
-		bld, err = p.buildGeneric(buildctx, builddir, result)
+		if p.outputOf != nil {
+			bld, err = p.buildNamedOutput(buildctx, result)
+		} else {
+			bld, err = p.buildGeneric(buildctx, builddir, result)
+		}
 	default:
-		err = xerrors.Errorf("cannot build package type: %s", p.Type)
+		bld, err = p.buildPlugin(buildctx, builddir, result)
 	}
 	if err != nil {
 		return err
@@ -735,19 +926,42 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 			pkgRep.Phases = append(pkgRep.Phases, phase)
 		}
 		log.WithField("phase", phase).WithField("package", p.FullName()).WithField("commands", bld.Commands[phase]).Debug("running commands")
-		err = executeCommandsForPackage(buildctx, p, builddir, cmds)
+		err = executeCommandsForPackage(buildctx, p, cg, builddir, phase, cmds)
+		if err == nil && phase == PackageBuildPhaseTest {
+			err = p.reportTestCoverage(buildctx, bld, pkgRep)
+		}
 		pkgRep.phaseDone[phase] = time.Now()
 		if err != nil {
 			return err
 		}
 	}
+	if bld.AfterBuild != nil {
+		err = bld.AfterBuild()
+		if err != nil {
+			return err
+		}
+	}
+
+	var outputs fileset
+	if len(p.Outputs) > 0 {
+		outputs, err = p.writeOutputList(builddir)
+		if err != nil {
+			return err
+		}
+	}
 
 	if p.C.W.Provenance.Enabled {
 		var (
 			subjects  []in_toto.Subject
 			resultDir = builddir
 		)
-		if bld.Subjects != nil {
+		if outputs != nil {
+			// declared outputs are exactly what the package produces
+			subjects, err = outputs.Subjects(builddir)
+			if err != nil {
+				return err
+			}
+		} else if bld.Subjects != nil {
 			subjects, err = bld.Subjects()
 			if err != nil {
 				return err
@@ -774,29 +988,177 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 		}
 	}
 
-	if bld.TestCoverage != nil {
-		coverage, funcsWithoutTest, funcsWithTest, err := bld.TestCoverage()
-		if err != nil {
-			return err
+	err = executeCommandsForPackage(buildctx, p, cg, builddir, PackageBuildPhasePackage, bld.Commands[PackageBuildPhasePackage])
+	if err != nil {
+		return err
+	}
+
+	err = buildctx.RegisterNewlyBuilt(p)
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+// outputListFilename is the file in the build directory which lists the files matching the outputs of a package.
+// The package phase of packages with outputs archives only those files.
+const outputListFilename = ".turbocache-outputs"
+
+// artifactContent returns the tar arguments which select what goes into the build artifact of a package
+func (p *Package) artifactContent() []string {
+	if len(p.Outputs) == 0 {
+		return []string{"."}
+	}
+	return []string{"--files-from", outputListFilename}
+}
+
+// resolveOutputs returns the files in the build directory which match the outputs of the package.
+// Outputs which match a directory select everything in it.
+func (p *Package) resolveOutputs(builddir string) (fileset, error) {
+	// Go packages remove their dependencies before packaging, hence they can never be outputs
+	depsDir := filepath.Join(builddir, "_deps") + string(filepath.Separator)
+	files, err := computeFileset(builddir, func(fn string) bool {
+		if p.Type == GoPackage && strings.HasPrefix(fn, depsDir) {
+			return true
+		}
+		return fn == filepath.Join(builddir, outputListFilename)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		res     = make(fileset)
+		matched = make(map[string]bool, len(p.Outputs))
+	)
+	for fn := range files {
+		for _, o := range p.Outputs {
+			for path := strings.TrimPrefix(fn, "/"); path != "." && path != "/"; path = filepath.Dir(path) {
+				m, err := doublestar.Match(o, path)
+				if err != nil {
+					return nil, xerrors.Errorf("invalid output %q: %w", o, err)
+				}
+				if m {
+					res[fn] = struct{}{}
+					matched[o] = true
+					break
+				}
+			}
+		}
+	}
+	for _, o := range p.Outputs {
+		if !matched[o] {
+			return nil, xerrors.Errorf("output %q did not match any file in the build directory", o)
 		}
+	}
+	return res, nil
+}
+
+// writeOutputList resolves the outputs of the package and writes them to the output list in the build directory
+func (p *Package) writeOutputList(builddir string) (fileset, error) {
+	outputs, err := p.resolveOutputs(builddir)
+	if err != nil {
+		return nil, err
+	}
 
-		pkgRep.TestCoverageAvailable = true
-		pkgRep.TestCoveragePercentage = coverage
-		pkgRep.FunctionsWithoutTest = funcsWithoutTest
-		pkgRep.FunctionsWithTest = funcsWithTest
+	lines := make([]string, 0, len(outputs)+1)
+	for fn := range outputs {
+		lines = append(lines, "."+fn)
 	}
+	if p.C.W.Provenance.Enabled {
+		lines = append(lines, "./"+provenanceBundleFilename)
+	}
+	sort.Strings(lines)
+	log.WithField("package", p.FullName()).WithField("outputs", lines).Debug("resolved package outputs")
 
-	err = executeCommandsForPackage(buildctx, p, builddir, bld.Commands[PackageBuildPhasePackage])
+	err = os.WriteFile(filepath.Join(builddir, outputListFilename), []byte(strings.Join(lines, "\n")+"\n"), 0644)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return outputs, nil
+}
 
-	err = buildctx.RegisterNewlyBuilt(p)
+// ListArtifactFiles returns the names of the regular files in a build artifact
+func ListArtifactFiles(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// the artifact name does not tell whether it's compressed, hence we look for the gzip magic number
+	var (
+		bf                 = bufio.NewReader(f)
+		in       io.Reader = bf
+		magic, _           = bf.Peek(2)
+	)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzin, err := gzip.NewReader(bf)
+		if err != nil {
+			return nil, err
+		}
+		defer gzin.Close()
+		in = gzin
+	}
+
+	var res []string
+	tarin := tar.NewReader(in)
+	for {
+		hdr, err := tarin.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("cannot list files of %s: %w", fn, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		res = append(res, strings.TrimPrefix(hdr.Name, "./"))
+	}
+	return res, nil
+}
+
+// reportTestCoverage collects the test coverage once the test phase has finished, and fails if it does not meet the minimum coverage of the package
+func (p *Package) reportTestCoverage(buildctx *buildContext, bld *packageBuild, pkgRep *PackageBuildReport) error {
+	var (
+		minCoverage = p.MinCoverage()
+		noCoverage  = func() error {
+			if minCoverage > 0 {
+				return xerrors.Errorf("package requires a test coverage of %d%%, but its build does not report test coverage", minCoverage)
+			}
+			return nil
+		}
+	)
+	if bld.TestCoverage == nil {
+		return noCoverage()
+	}
+
+	coverage, funcsWithoutTest, funcsWithTest, err := bld.TestCoverage()
+	if errors.Is(err, errNoTestCoverage) {
+		return noCoverage()
+	}
 	if err != nil {
 		return err
 	}
+	pkgRep.TestCoverageAvailable = true
+	pkgRep.TestCoveragePercentage = coverage
+	pkgRep.FunctionsWithoutTest = funcsWithoutTest
+	pkgRep.FunctionsWithTest = funcsWithTest
 
-	return err
+	if bld.LineCoverage != nil && buildctx.CoverageOutputPath != "" {
+		cov, err := bld.LineCoverage()
+		if err != nil {
+			return err
+		}
+		buildctx.RegisterLineCoverage(cov)
+	}
+
+	if coverage < minCoverage {
+		return xerrors.Errorf("test coverage of %d%% is below the required minimum of %d%%", coverage, minCoverage)
+	}
+	return nil
 }
 
 // Collects the minimal set of packages to download from the remote cache
@@ -819,7 +1181,7 @@ func (p *Package) packagesToDownload(inLocalCache map[*Package]struct{}, inRemot
 		toDownload[p] = struct{}{}
 
 		// For Generic and Docker packages we can short-circuit here.
-		// For Yarn and Go we can not, see comment below for details.
+		// For Yarn, Go, Rust and Python we can not, see comment below for details.
 		switch p.Type {
 		case GenericPackage, DockerPackage:
 			return
@@ -828,18 +1190,21 @@ func (p *Package) packagesToDownload(inLocalCache map[*Package]struct{}, inRemot
 
 	var deps []*Package
 	switch p.Type {
-	// For Go and Yarn packages we need all transitive dependencies of a component to be available on disk
+	// For Go, Rust, Python and Yarn packages we need all transitive dependencies of a component to be available on disk
 	// to perform a build.
 	//
 	// Example: components/ee/agent-smith:app depends on components/nxpod-protocol/go:lib
 	// 			components/nxpod-protocol/go:lib depends on components/nxpod-protocol:nxpod-schema
 	// 			To build components/ee/agent-smith:app it is not enough to just download components/nxpod-protocol/go:lib
 	// 			as we also need components/nxpod-protocol:nxpod-schema to be available on disk to perform the build.
-	case YarnPackage, GoPackage:
+	case YarnPackage, GoPackage, RustPackage, PythonPackage:
 		deps = p.GetTransitiveDependencies()
 	// For Generic and Docker packages it is sufficient to have the direct dependencies.
 	case GenericPackage, DockerPackage:
 		deps = p.GetDependencies()
+	// Plugins receive the locations of all transitive dependencies.
+	default:
+		deps = p.GetTransitiveDependencies()
 	}
 
 	for _, p := range deps {
@@ -868,12 +1233,20 @@ type packageBuild struct {
 	// package build. This field takes precedence over PostBuild
 	Subjects func() ([]in_toto.Subject, error)
 
+	// If AfterBuild is not nil it's called once all phases up to and including the build phase succeeded.
+	AfterBuild func() error
+
 	// If TestCoverage is not nil it's used to compute the test coverage of the package build.
 	// This function is expected to return a value between 0 and 100.
 	// If the package build does not have any tests, this function must return 0.
 	// If the package build has tests but the test coverage cannot be computed, this function must return an error.
+	// If the tests did not produce a coverage report, this function must return errNoTestCoverage.
 	// This function is guaranteed to be called after the test phase has finished.
 	TestCoverage testCoverageFunc
+
+	// If LineCoverage is not nil it's used to add the package to the merged coverage report of the build.
+	// Like TestCoverage, this function is called after the test phase has finished.
+	LineCoverage lineCoverageFunc
 }
 
 type testCoverageFunc func() (coverage, funcsWithoutTest, funcsWithTest int, err error)
@@ -911,6 +1284,11 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 		return nil, xerrors.Errorf("package should have yarn config")
 	}
 
+	if isYarnBerry(wd) {
+		// Yarn 2+ has none of the Yarn 1 features we build upon below, but works much like pnpm and npm
+		return p.buildJS(buildctx, wd, result, jsPackageManagerYarnBerry)
+	}
+
 	var (
 		fn           = filepath.Join(p.C.Origin, "package.json")
 		pkgjsonFound bool
@@ -942,14 +1320,9 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 		}...)
 	}
 
-	// We don't check if ephemeral packages in the transitive dependency tree have been built,
-	// as they may be too far down the tree to trigger a build (e.g. their parent may be built already).
-	// Hence, we need to ensure all direct dependencies on ephemeral packages have been built.
-	for _, deppkg := range p.GetDependencies() {
-		_, ok := buildctx.LocalCache.Location(deppkg)
-		if deppkg.Ephemeral && !ok {
-			return nil, PkgNotBuiltErr{deppkg}
-		}
+	err = p.checkEphemeralDependencies(buildctx)
+	if err != nil {
+		return nil, err
 	}
 
 	pkgYarnLock := "pkg-yarn.lock"
@@ -970,12 +1343,12 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 			builtpkg = filepath.Join(wd, "_mirror", fn)
 		}
 
-		var isTSLibrary bool
-		if deppkg.Type == YarnPackage {
-			cfg, ok := deppkg.Config.(YarnPkgConfig)
-			if ok && cfg.Packaging == YarnLibrary {
-				isTSLibrary = true
-			}
+		isTSLibrary := isJSLibrary(deppkg)
+		if isTSLibrary && deppkg.JSPackageManager() != JSPackageManagerYarn {
+			return nil, xerrors.Errorf("%s: cannot depend on %s which is built using %s - Yarn 1 packages can only depend on libraries built using Yarn 1", p.FullName(), deppkg.FullName(), deppkg.JSPackageManager())
+		}
+		if isTSLibrary && isYarnBerry(deppkg.C.Origin) {
+			return nil, xerrors.Errorf("%s: cannot depend on %s which is built using Yarn 2+ - Yarn 1 packages can only depend on libraries built using Yarn 1", p.FullName(), deppkg.FullName())
 		}
 		if isTSLibrary {
 			// make previously built package availabe through yarn lock
@@ -1078,6 +1451,9 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 	res := &packageBuild{
 		Commands: commands,
 	}
+	if !cfg.DontTest && !buildctx.DontTest {
+		res.TestCoverage, res.LineCoverage = p.collectJSTestCoverage(cfg, wd)
+	}
 
 	// let's prepare for packaging
 	var (
@@ -1150,218 +1526,1097 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 	return res, nil
 }
 
-// buildGo implements the build process for Go packages.
-// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
-func (p *Package) buildGo(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
-	cfg, ok := p.Config.(GoPkgConfig)
-	if !ok {
-		return nil, xerrors.Errorf("package should have Go config")
-	}
-
-	if _, err := os.Stat(filepath.Join(wd, "go.mod")); os.IsNotExist(err) {
-		return nil, xerrors.Errorf("can only build Go modules (missing go.mod file)")
+// isJSLibrary returns true if the package is a yarn package with library packaging
+func isJSLibrary(p *Package) bool {
+	if p.Type != YarnPackage {
+		return false
 	}
+	cfg, ok := p.Config.(YarnPkgConfig)
+	return ok && cfg.Packaging == YarnLibrary
+}
 
-	var (
-		commands      = make(map[PackageBuildPhase][][]string)
-		isGoWorkspace bool
-		workFile      *modfile.WorkFile
-	)
-	if fc, err := os.ReadFile(filepath.Join(p.C.W.Origin, "go.work")); err == nil {
-		isGoWorkspace = true
+// jsPackageManagerYarnBerry is Yarn 2 or later. We detect Yarn 2+ from the package's files, hence it cannot be configured.
+const jsPackageManagerYarnBerry JSPackageManager = "yarn-berry"
 
-		workFile, err = modfile.ParseWork("go.work", fc, nil)
-		if err != nil {
-			return nil, xerrors.Errorf("cannot read go.work file: %w", err)
-		}
-		// we drop all use statements and later add the correct ones back in, starting with the src itself
-		for _, use := range workFile.Use {
-			err = workFile.DropUse(use.Path)
-			if err != nil {
-				return nil, err
+// isYarnBerry returns true if the project in dir uses Yarn 2 or later, i.e. it has a .yarnrc.yml which configures a yarnPath,
+// or a yarn.lock in the Yarn 2+ format.
+func isYarnBerry(dir string) bool {
+	if fc, err := os.ReadFile(filepath.Join(dir, ".yarnrc.yml")); err == nil {
+		for _, l := range strings.Split(string(fc), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(l), "yarnPath:") {
+				return true
 			}
 		}
-		workFile.AddNewUse("./", "")
-		workFile.SortBlocks()
-		workFile.Cleanup()
-		fc = modfile.Format(workFile.Syntax)
-		err = os.WriteFile(filepath.Join(wd, "go.work"), fc, 0644)
-		if err != nil {
-			return nil, err
+	}
+	if fc, err := os.ReadFile(filepath.Join(dir, "yarn.lock")); err == nil {
+		for _, l := range strings.Split(string(fc), "\n") {
+			if strings.HasPrefix(l, "__metadata:") {
+				return true
+			}
 		}
-
-	} else if !os.IsNotExist(err) {
-		return nil, xerrors.Errorf("cannot read go.work file: %w", err)
 	}
+	return false
+}
 
-	var goCommand = "go"
-	if cfg.GoVersion != "" {
-		goCommand = cfg.GoVersion
-		commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], [][]string{
-			{"sh", "-c", "GO111MODULE=off go get golang.org/dl/" + cfg.GoVersion},
-			{goCommand, "download"},
-		}...)
+// buildJS implements the build process for yarn packages which use pnpm, npm or Yarn 2+ as package manager.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildJS(buildctx *buildContext, wd, result string, pm JSPackageManager) (bld *packageBuild, err error) {
+	cfg, ok := p.Config.(YarnPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have yarn config")
+	}
+	var (
+		bin = string(pm)
+		// berryEnv keeps the Yarn 2+ cache within the package, which makes the cache portable
+		berryEnv = []string{"env", "YARN_ENABLE_GLOBAL_CACHE=false"}
+	)
+	switch pm {
+	case JSPackageManagerPNPM, JSPackageManagerNPM:
+	case jsPackageManagerYarnBerry:
+		bin = "yarn"
+	default:
+		return nil, xerrors.Errorf("unsupported package manager: %s", pm)
 	}
 
-	// We don't check if ephemeral packages in the transitive dependency tree have been built,
-	// as they may be too far down the tree to trigger a build (e.g. their parent may be built already).
-	// Hence, we need to ensure all direct dependencies on ephemeral packages have been built.
-	for _, deppkg := range p.GetDependencies() {
-		_, ok := buildctx.LocalCache.Location(deppkg)
-		if deppkg.Ephemeral && !ok {
+	var (
+		fn           = filepath.Join(p.C.Origin, "package.json")
+		pkgjsonFound bool
+	)
+	for _, src := range p.Sources {
+		if src == fn {
+			pkgjsonFound = true
+			break
+		}
+	}
+	if !pkgjsonFound {
+		return nil, xerrors.Errorf("%s: yarn packages must have a package.json", p.FullName())
+	}
+	if cfg.Packaging == YarnOfflineMirror {
+		return nil, xerrors.Errorf("%s: %s packaging is only supported with Yarn 1 as package manager", p.FullName(), cfg.Packaging)
+	}
+
+	version, err := p.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.checkEphemeralDependencies(buildctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		commands = make(map[PackageBuildPhase][][]string)
+		// localDeps maps the npm package name of library dependencies to their built tarball
+		localDeps = make(map[string]string)
+	)
+	for _, deppkg := range p.GetTransitiveDependencies() {
+		if deppkg.Ephemeral {
+			continue
+		}
+
+		builtpkg, ok := buildctx.LocalCache.Location(deppkg)
+		if !ok {
 			return nil, PkgNotBuiltErr{deppkg}
 		}
+
+		if isJSLibrary(deppkg) {
+			name, err := readPackageJSONName(filepath.Join(deppkg.C.Origin, "package.json"))
+			if err != nil {
+				return nil, xerrors.Errorf("cannot determine npm package name of %s: %w", deppkg.FullName(), err)
+			}
+			localDeps[name] = "file:" + builtpkg
+			continue
+		}
+
+		tgt := p.BuildLayoutLocation(deppkg)
+		commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], [][]string{
+			{"mkdir", tgt},
+			{"tar", "xfz", builtpkg, "--no-same-owner", "-C", tgt},
+		}...)
+	}
+
+	pkgJSONFilename := filepath.Join(wd, "package.json")
+	var packageJSON map[string]interface{}
+	fc, err := os.ReadFile(pkgJSONFilename)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+	}
+	err = json.Unmarshal(fc, &packageJSON)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+	}
+	if len(localDeps) > 0 {
+		err = patchJSDependencies(packageJSON, localDeps, pm)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+		}
+		fc, err = json.Marshal(packageJSON)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+		}
+		err = os.WriteFile(pkgJSONFilename, fc, 0644)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+		}
+	}
+	pkgname, ok := packageJSON["name"].(string)
+	if !ok || pkgname == "" {
+		return nil, xerrors.Errorf("name in package.json must be a non-empty string")
+	}
+
+	if pm == JSPackageManagerPNPM && cfg.Packaging == YarnApp {
+		// pnpm deploy only works within a pnpm workspace
+		fn := filepath.Join(wd, "pnpm-workspace.yaml")
+		if _, err := os.Stat(fn); os.IsNotExist(err) {
+			err = os.WriteFile(fn, []byte("packages:\n  - \".\"\n"), 0644)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], p.PreparationCommands...)
+
+	// The lockfile cannot be frozen: we have just pointed the workspace-internal dependencies to their built tarballs.
+	var installCmd []string
+	switch pm {
+	case JSPackageManagerPNPM:
+		installCmd = []string{"pnpm", "install", "--no-frozen-lockfile"}
+	case JSPackageManagerNPM:
+		installCmd = []string{"npm", "install", "--no-audit", "--no-fund"}
+	case jsPackageManagerYarnBerry:
+		installCmd = append(berryEnv, "yarn", "install", "--no-immutable")
+	}
+	if len(cfg.Commands.Install) > 0 {
+		installCmd = cfg.Commands.Install
+	}
+	commands[PackageBuildPhasePull] = append(commands[PackageBuildPhasePull], installCmd)
+	if len(cfg.Commands.Build) == 0 {
+		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], []string{bin, "run", "build"})
+	} else {
+		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], cfg.Commands.Build)
+	}
+	if !cfg.DontTest && !buildctx.DontTest {
+		if len(cfg.Commands.Test) == 0 {
+			commands[PackageBuildPhaseTest] = append(commands[PackageBuildPhaseTest], []string{bin, "test"})
+		} else {
+			commands[PackageBuildPhaseTest] = append(commands[PackageBuildPhaseTest], cfg.Commands.Test)
+		}
+	}
+
+	var (
+		pkgCommands [][]string
+		resultDir   string
+	)
+	switch cfg.Packaging {
+	case YarnLibrary:
+		if pm == jsPackageManagerYarnBerry {
+			pkgCommands = append(pkgCommands, []string{"yarn", "pack", "--out", result})
+			break
+		}
+		pkgCommands = append(pkgCommands, [][]string{
+			{"mkdir", "-p", "_pack"},
+			{bin, "pack", "--pack-destination", "_pack"},
+			{"sh", "-c", fmt.Sprintf("mv _pack/*.tgz %s", result)},
+		}...)
+	case YarnApp:
+		if pm == jsPackageManagerYarnBerry {
+			// focus drops all but the production dependencies from the install, including the cache which lives in the package
+			pkgCommands = append(pkgCommands, [][]string{
+				append(berryEnv, "yarn", "workspaces", "focus", "--production"),
+				{"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "."},
+			}...)
+			break
+		}
+		switch pm {
+		case JSPackageManagerPNPM:
+			pkgCommands = append(pkgCommands, []string{"pnpm", "--filter", pkgname, "deploy", "--prod", "_pkg"})
+		case JSPackageManagerNPM:
+			// much like for yarn we install the packed package into an otherwise empty project
+			err := os.Mkdir(filepath.Join(wd, "_pkg"), 0755)
+			if err != nil {
+				return nil, err
+			}
+			installer := map[string]interface{}{
+				"name":         "local",
+				"version":      version,
+				"license":      "UNLICENSED",
+				"dependencies": map[string]interface{}{pkgname: "file:../package.tgz"},
+			}
+			err = patchJSDependencies(installer, localDeps, pm)
+			if err != nil {
+				return nil, err
+			}
+			fc, err := json.Marshal(installer)
+			if err != nil {
+				return nil, err
+			}
+			err = os.WriteFile(filepath.Join(wd, "_pkg", "package.json"), fc, 0644)
+			if err != nil {
+				return nil, err
+			}
+
+			pkgCommands = append(pkgCommands, [][]string{
+				{"mkdir", "-p", "_pack"},
+				{"npm", "pack", "--pack-destination", "_pack"},
+				{"sh", "-c", "mv _pack/*.tgz package.tgz"},
+				{"npm", "install", "--prefix", "_pkg", "--omit=dev", "--no-audit", "--no-fund"},
+			}...)
+		}
+		pkgCommands = append(pkgCommands, []string{"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "-C", "_pkg", "."})
+		resultDir = "_pkg"
+	case YarnArchive:
+		pkgCommands = append(pkgCommands, []string{"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "."})
+	default:
+		return nil, xerrors.Errorf("unknown Yarn packaging: %s", cfg.Packaging)
+	}
+	commands[PackageBuildPhasePackage] = pkgCommands
+
+	res := &packageBuild{
+		Commands: commands,
+	}
+	if !cfg.DontTest && !buildctx.DontTest {
+		res.TestCoverage, res.LineCoverage = p.collectJSTestCoverage(cfg, wd)
+	}
+	res.PostBuild = func(sources fileset) (subjects []in_toto.Subject, absResultDir string, err error) {
+		ignoreNodeModules := func(fn string) bool { return strings.Contains(fn, "node_modules/") }
+		fn := filepath.Join(wd, resultDir)
+		postBuild, err := computeFileset(fn, ignoreNodeModules)
+		if err != nil {
+			return nil, fn, err
+		}
+		subjects, err = postBuild.Sub(sources).Subjects(fn)
+		absResultDir = filepath.Join(wd, resultDir)
+		return
+	}
+
+	return res, nil
+}
+
+// readPackageJSONName returns the name of the npm package defined by a package.json file
+func readPackageJSONName(fn string) (string, error) {
+	fc, err := os.ReadFile(fn)
+	if err != nil {
+		return "", err
+	}
+	var pkgjson struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(fc, &pkgjson)
+	if err != nil {
+		return "", err
+	}
+	if pkgjson.Name == "" {
+		return "", xerrors.Errorf("%s has no name", fn)
+	}
+	return pkgjson.Name, nil
+}
+
+// patchJSDependencies points the workspace-internal dependencies of a package.json to the tarballs of the libraries
+// turbocache built. Overrides make sure the dependencies of those libraries resolve to the built tarballs, too.
+func patchJSDependencies(packageJSON map[string]interface{}, localDeps map[string]string, pm JSPackageManager) error {
+	if len(localDeps) == 0 {
+		return nil
+	}
+
+	for _, section := range []string{"dependencies", "devDependencies", "optionalDependencies"} {
+		rdeps, ok := packageJSON[section]
+		if !ok {
+			continue
+		}
+		deps, ok := rdeps.(map[string]interface{})
+		if !ok {
+			return xerrors.Errorf("%s is not an object", section)
+		}
+		for name := range deps {
+			if spec, ok := localDeps[name]; ok {
+				deps[name] = spec
+			}
+		}
+	}
+
+	var (
+		parent = packageJSON
+		key    = "overrides"
+	)
+	if pm == jsPackageManagerYarnBerry {
+		key = "resolutions"
+	}
+	if pm == JSPackageManagerPNPM {
+		rpnpm, ok := packageJSON["pnpm"]
+		if !ok {
+			rpnpm = make(map[string]interface{})
+			packageJSON["pnpm"] = rpnpm
+		}
+		parent, ok = rpnpm.(map[string]interface{})
+		if !ok {
+			return xerrors.Errorf("pnpm is not an object")
+		}
+	}
+	roverrides, ok := parent[key]
+	if !ok {
+		roverrides = make(map[string]interface{})
+		parent[key] = roverrides
+	}
+	overrides, ok := roverrides.(map[string]interface{})
+	if !ok {
+		return xerrors.Errorf("%s is not an object", key)
+	}
+	for name, spec := range localDeps {
+		overrides[name] = spec
+	}
+
+	return nil
+}
+
+// checkEphemeralDependencies ensures all direct dependencies of this package on ephemeral packages have been built.
+// We don't check if ephemeral packages in the transitive dependency tree have been built,
+// as they may be too far down the tree to trigger a build (e.g. their parent may be built already).
+func (p *Package) checkEphemeralDependencies(buildctx *buildContext) error {
+	for _, deppkg := range p.GetDependencies() {
+		_, ok := buildctx.LocalCache.Location(deppkg)
+		if deppkg.Ephemeral && !ok {
+			return PkgNotBuiltErr{deppkg}
+		}
+	}
+	return nil
+}
+
+// unpackedDependency is a dependency whose build artifact is unpacked into the build directory
+type unpackedDependency struct {
+	Package *Package
+	// Location is the directory the artifact is unpacked to, relative to the build directory
+	Location string
+}
+
+// unpackDependencies returns the prep commands which unpack the build artifacts of all transitive dependencies
+// of this package into dir, but those of ephemeral packages.
+func (p *Package) unpackDependencies(buildctx *buildContext, dir string) (cmds [][]string, deps []unpackedDependency, err error) {
+	err = p.checkEphemeralDependencies(buildctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transdep := p.GetTransitiveDependencies()
+	if len(transdep) == 0 {
+		return nil, nil, nil
+	}
+	cmds = append(cmds, []string{"mkdir", dir})
+	for _, dep := range transdep {
+		if dep.Ephemeral {
+			continue
+		}
+
+		builtpkg, ok := buildctx.LocalCache.Location(dep)
+		if !ok {
+			return nil, nil, PkgNotBuiltErr{dep}
+		}
+
+		tgt := filepath.Join(dir, p.BuildLayoutLocation(dep))
+		cmds = append(cmds, [][]string{
+			{"mkdir", tgt},
+			{"tar", "xfz", builtpkg, "--no-same-owner", "-C", tgt},
+		}...)
+		deps = append(deps, unpackedDependency{Package: dep, Location: tgt})
+	}
+	return cmds, deps, nil
+}
+
+// buildGo implements the build process for Go packages.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildGo(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	cfg, ok := p.Config.(GoPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have Go config")
+	}
+	if cfg.Packaging == GoModCache {
+		return p.buildGoModCache(buildctx, cfg, wd, result)
+	}
+
+	if _, err := os.Stat(filepath.Join(wd, "go.mod")); os.IsNotExist(err) {
+		return nil, xerrors.Errorf("can only build Go modules (missing go.mod file)")
+	}
+	err = p.C.W.GoCaches().Ensure()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		commands      = make(map[PackageBuildPhase][][]string)
+		isGoWorkspace bool
+		workFile      *modfile.WorkFile
+	)
+	if fc, err := os.ReadFile(filepath.Join(p.C.W.Origin, "go.work")); err == nil {
+		isGoWorkspace = true
+
+		workFile, err = modfile.ParseWork("go.work", fc, nil)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read go.work file: %w", err)
+		}
+		// we drop all use statements and later add the correct ones back in, starting with the src itself
+		for _, use := range workFile.Use {
+			err = workFile.DropUse(use.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		workFile.AddNewUse("./", "")
+		workFile.SortBlocks()
+		workFile.Cleanup()
+		fc = modfile.Format(workFile.Syntax)
+		err = os.WriteFile(filepath.Join(wd, "go.work"), fc, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+	} else if !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("cannot read go.work file: %w", err)
+	}
+
+	// The toolchain is selected through GOTOOLCHAIN, see goEnvironment
+	var goCommand = "go"
+
+	transdep := p.GetTransitiveDependencies()
+	var modcaches []string
+	for _, dep := range transdep {
+		if isGoModCache(dep) && !dep.Ephemeral {
+			modcaches = append(modcaches, dep.FullName())
+		}
+	}
+	if len(modcaches) > 1 {
+		return nil, xerrors.Errorf("can build against one Go module cache only, but depends on %s", strings.Join(modcaches, ", "))
+	}
+
+	unpackCmds, unpacked, err := p.unpackDependencies(buildctx, "_deps")
+	if err != nil {
+		return nil, err
+	}
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], unpackCmds...)
+	for _, dep := range unpacked {
+		if dep.Package.Type != GoPackage || isGoModCache(dep.Package) {
+			continue
+		}
+
+		tgt := dep.Location
+		if isGoWorkspace {
+			commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{"go", "work", "use", tgt})
+		} else {
+			commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{"sh", "-c", fmt.Sprintf("%s mod edit -replace $(cd %s; grep module go.mod | cut -d ' ' -f 2 | head -n1)=./%s", goCommand, tgt, tgt)})
+		}
+	}
+
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], p.PreparationCommands...)
+	if cfg.Generate {
+		commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{goCommand, "generate", "-v", "./..."})
+	}
+
+	dlcmd := []string{goCommand, "mod", "download"}
+	if log.IsLevelEnabled(log.DebugLevel) {
+		dlcmd = append(dlcmd, "-x")
+	}
+	commands[PackageBuildPhasePull] = append(commands[PackageBuildPhasePull], dlcmd)
+
+	if !cfg.DontCheckGoFmt {
+		commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], []string{"sh", "-c", `if [ ! $(go fmt ./... | wc -l) -eq 0 ]; then echo; echo; echo please gofmt your code; echo; echo; exit 1; fi`})
+	}
+	if !cfg.DontLint {
+		if len(cfg.LintCommand) == 0 {
+			commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], []string{"golangci-lint", "run"})
+		} else {
+			commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], cfg.LintCommand)
+		}
+	}
+	var (
+		reportCoverage testCoverageFunc
+		lineCoverage   lineCoverageFunc
+	)
+	if !cfg.DontTest && !buildctx.DontTest {
+		testCommand := []string{goCommand, "test"}
+		if log.IsLevelEnabled(log.DebugLevel) {
+			testCommand = append(testCommand, "-v")
+		}
+
+		testCommand = append(testCommand, "-coverprofile=testcoverage.out")
+		reportCoverage = collectGoTestCoverage(filepath.Join(wd, "testcoverage.out"))
+		lineCoverage = p.collectGoLineCoverage(filepath.Join(wd, "testcoverage.out"), filepath.Join(wd, "go.mod"))
+		testCommand = append(testCommand, "./...")
+
+		commands[PackageBuildPhaseTest] = append(commands[PackageBuildPhaseTest], testCommand)
+	}
+
+	var buildCmd []string
+	if len(cfg.BuildCommand) > 0 {
+		buildCmd = cfg.BuildCommand
+	} else if cfg.Packaging == GoApp && len(cfg.Platforms) == 0 {
+		buildCmd = []string{goCommand, "build"}
+		buildCmd = append(buildCmd, cfg.BuildFlags...)
+		buildCmd = append(buildCmd, ".")
+	}
+	if len(buildCmd) > 0 && cfg.Packaging != GoLibrary {
+		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], buildCmd)
+	}
+	for _, platform := range cfg.Platforms {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		// the trailing slash makes go build place the binary named as usual in that directory
+		cmd := []string{"env", "GOOS=" + goos, "GOARCH=" + goarch, goCommand, "build", "-o", goPlatformDir(platform) + "/"}
+		cmd = append(cmd, cfg.BuildFlags...)
+		cmd = append(cmd, ".")
+		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], cmd)
+	}
+
+	commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], []string{"rm", "-rf", "_deps"})
+	commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], append([]string{
+		"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor),
+	}, p.artifactContent()...))
+	if !cfg.DontTest && !buildctx.DontTest && buildctx.buildOptions.CoverageOutputPath != "" {
+		commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], [][]string{
+			{"sh", "-c", fmt.Sprintf(`if [ -f testcoverage.out ]; then cp -f testcoverage.out %v; fi`, filepath.Join(buildctx.buildOptions.CoverageOutputPath, codecovComponentName(p.FullName())))},
+		}...)
+	}
+
+	res = &packageBuild{
+		Commands:     commands,
+		TestCoverage: reportCoverage,
+		LineCoverage: lineCoverage,
+	}
+	if len(cfg.Platforms) > 0 {
+		// each binary becomes a subject of its own, rather than everything the build produced
+		platformDirs := make([]string, 0, len(cfg.Platforms))
+		for _, platform := range cfg.Platforms {
+			platformDirs = append(platformDirs, filepath.Join(wd, goPlatformDir(platform))+string(filepath.Separator))
+		}
+		res.PostBuild = func(sources fileset) (subj []in_toto.Subject, absResultDir string, err error) {
+			notABinary := func(fn string) bool {
+				for _, dir := range platformDirs {
+					if strings.HasPrefix(fn, dir) {
+						return false
+					}
+				}
+				return true
+			}
+			binaries, err := computeFileset(wd, notABinary)
+			if err != nil {
+				return nil, wd, err
+			}
+			subj, err = binaries.Subjects(wd)
+			return subj, wd, err
+		}
+	}
+
+	return res, nil
+}
+
+// goModCacheDir is the directory within the build directory of a modcache package which holds the module cache
+const goModCacheDir = "_modcache"
+
+// buildGoModCache implements the build process for Go packages with modcache packaging
+func (p *Package) buildGoModCache(buildctx *buildContext, cfg GoPkgConfig, wd, result string) (res *packageBuild, err error) {
+	commands := make(map[PackageBuildPhase][][]string)
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{"mkdir", "-p", goModCacheDir})
+
+	var modules []string
+	if cfg.WorkspaceModules {
+		// We lay the go.mod files out as they are in the workspace, so that relative replace directives keep working.
+		for _, fn := range p.goModuleFiles {
+			rel, err := filepath.Rel(p.C.W.Origin, filepath.Dir(fn))
+			if err != nil {
+				return nil, err
+			}
+			dir := filepath.Join("_modules", rel)
+			tgt := filepath.Join(dir, "go.sum")
+			if strings.HasSuffix(fn, ".mod") {
+				tgt = filepath.Join(dir, "go.mod")
+				modules = append(modules, dir)
+			}
+			commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], [][]string{
+				{"mkdir", "-p", dir},
+				{"cp", fn, tgt},
+			}...)
+		}
+	} else {
+		if _, err := os.Stat(filepath.Join(wd, "go.mod")); os.IsNotExist(err) {
+			return nil, xerrors.Errorf("can only build Go modules (missing go.mod file)")
+		}
+		modules = []string{"."}
+	}
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], p.PreparationCommands...)
+
+	for _, dir := range modules {
+		// -modcacherw keeps the module cache removable once dependent packages have unpacked it
+		dlcmd := []string{"go", "-C", dir, "mod", "download", "-modcacherw"}
+		if log.IsLevelEnabled(log.DebugLevel) {
+			dlcmd = append(dlcmd, "-x")
+		}
+		commands[PackageBuildPhasePull] = append(commands[PackageBuildPhasePull], dlcmd)
+	}
+
+	commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], []string{
+		"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "-C", goModCacheDir, ".",
+	})
+
+	return &packageBuild{
+		Commands: commands,
+	}, nil
+}
+
+// isGoModCache returns true if the package is a Go package with modcache packaging
+func isGoModCache(p *Package) bool {
+	cfg, ok := p.Config.(GoPkgConfig)
+	return ok && cfg.Packaging == GoModCache
+}
+
+// collectJSTestCoverage reads the test coverage of yarn packages from the istanbul coverage-summary.json
+// or lcov.info the tests produced in the coverage directory.
+func (p *Package) collectJSTestCoverage(cfg YarnPkgConfig, wd string) (testCoverageFunc, lineCoverageFunc) {
+	coverageDir := cfg.CoverageDir
+	if coverageDir == "" {
+		coverageDir = "coverage"
+	}
+	var (
+		summaryFN = filepath.Join(wd, coverageDir, "coverage-summary.json")
+		lcovFN    = filepath.Join(wd, coverageDir, "lcov.info")
+	)
+	readLCOV := func() (lineCoverage, lcovTotals, error) {
+		dir, err := filepath.Rel(p.C.W.Origin, p.C.Origin)
+		if err != nil {
+			return nil, lcovTotals{}, err
+		}
+		f, err := os.Open(lcovFN)
+		if err != nil {
+			return nil, lcovTotals{}, err
+		}
+		defer f.Close()
+		return parseLCOV(f, wd, dir)
+	}
+
+	testCoverage := func() (coverage, funcsWithoutTest, funcsWithTest int, err error) {
+		if f, err := os.Open(summaryFN); err == nil {
+			defer f.Close()
+			return parseIstanbulSummary(f)
+		} else if !os.IsNotExist(err) {
+			return 0, 0, 0, err
+		}
+
+		_, totals, err := readLCOV()
+		if os.IsNotExist(err) {
+			return 0, 0, 0, errNoTestCoverage
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return totals.Coverage(), totals.FunctionsFound - totals.FunctionsHit, totals.FunctionsHit, nil
+	}
+	lineCoverage := func() (lineCoverage, error) {
+		cov, _, err := readLCOV()
+		if os.IsNotExist(err) {
+			// coverage-summary.json has no line information
+			return nil, nil
+		}
+		return cov, err
+	}
+	return testCoverage, lineCoverage
+}
+
+func collectGoTestCoverage(covfile string) testCoverageFunc {
+	return func() (coverage, funcsWithoutTest, funcsWithTest int, err error) {
+		// We need to collect the coverage for all packages in the module.
+		// To that end we load the coverage file.
+		// The coverage file contains the coverage for all packages in the module.
+
+		cmd := exec.Command("go", "tool", "cover", "-func", covfile)
+		log.WithField("pwd", filepath.Dir(covfile)).WithField("covfile", covfile).Debug("collecting test coverage")
+		cmd.Dir = filepath.Dir(covfile)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			err = xerrors.Errorf("cannot collect test coverage: %w: %s", err, string(out))
+			return
+		}
+
+		coverage, funcsWithoutTest, funcsWithTest, err = parseGoCoverOutput(string(out))
+		return
+	}
+}
+
+// collectGoLineCoverage reads the line coverage from the cover profile of a Go package build
+func (p *Package) collectGoLineCoverage(covfile, gomod string) lineCoverageFunc {
+	return func() (lineCoverage, error) {
+		fc, err := os.ReadFile(gomod)
+		if err != nil {
+			return nil, err
+		}
+		modulePath := modfile.ModulePath(fc)
+		dir, err := filepath.Rel(p.C.W.Origin, p.C.Origin)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(covfile)
+		if os.IsNotExist(err) {
+			// packages without tests don't produce a cover profile
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseGoCoverProfile(f, modulePath, dir)
+	}
+}
+
+func parseGoCoverOutput(input string) (coverage, funcsWithoutTest, funcsWithTest int, err error) {
+	// The output of the coverage tool looks like this:
+	// github.com/khulnasoft/nxpod/content_ws/pkg/contentws/contentws.go:33:	New		100.0%
+	// total:							(statements)	63.3%
+	// The total is weighed by the number of statements, hence is what we report as coverage.
+	lines := strings.Split(input, "\n")
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		perc := strings.Trim(strings.TrimSpace(fields[2]), "%")
+		percF, err := strconv.ParseFloat(perc, 32)
+		if err != nil {
+			log.Warnf("cannot parse coverage percentage for line %s: %v", line, err)
+			continue
+		}
+		if fields[0] == "total:" {
+			coverage = int(percF)
+			continue
+		}
+		if int(percF) == 0 {
+			funcsWithoutTest++
+		} else {
+			funcsWithTest++
+		}
+	}
+	return
+}
+
+// buildRust implements the build process for Rust packages.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildRust(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	cfg, ok := p.Config.(RustPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have Rust config")
+	}
+
+	if _, err := os.Stat(filepath.Join(wd, "Cargo.toml")); os.IsNotExist(err) {
+		return nil, xerrors.Errorf("can only build Rust crates (missing Cargo.toml file)")
+	}
+
+	var (
+		commands = make(map[PackageBuildPhase][][]string)
+		// cargoFlags are passed to all cargo commands
+		cargoFlags []string
+	)
+	unpackCmds, unpacked, err := p.unpackDependencies(buildctx, "_deps")
+	if err != nil {
+		return nil, err
+	}
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], unpackCmds...)
+	if len(unpacked) > 0 {
+		// The crates in the dependency tree may declare the lib crates we build with any source, hence we need all their manifests.
+		manifest, err := os.ReadFile(filepath.Join(wd, "Cargo.toml"))
+		if err != nil {
+			return nil, err
+		}
+		manifests := map[string]string{p.FullName(): string(manifest)}
+		libs := make(map[*Package]string)
+		for _, dep := range unpacked {
+			if depcfg, ok := dep.Package.Config.(RustPkgConfig); !ok || depcfg.Packaging != RustLib {
+				continue
+			}
+			manifest, err := os.ReadFile(filepath.Join(dep.Package.C.Origin, "Cargo.toml"))
+			if err != nil {
+				return nil, xerrors.Errorf("cannot read Cargo.toml of %s: %w", dep.Package.FullName(), err)
+			}
+			manifests[dep.Package.FullName()] = string(manifest)
+			libs[dep.Package] = dep.Location
+		}
+
+		var patches []string
+		for dep, tgt := range libs {
+			crate, err := cargoPackageName(manifests[dep.FullName()])
+			if err != nil {
+				return nil, xerrors.Errorf("cannot determine crate name of %s: %w", dep.FullName(), err)
+			}
+
+			// Much like go mod edit -replace for Go packages we patch the dependency to point to the built crate.
+			// Passing the [patch] section as cargo config leaves the Cargo.toml of the package untouched.
+			// Crates without an explicit source come from crates.io.
+			sources := map[string]struct{}{"crates-io": {}}
+			for name, manifest := range manifests {
+				srcs, err := cargoDependencySources(manifest, crate)
+				if err != nil {
+					return nil, xerrors.Errorf("%s: %w", name, err)
+				}
+				for _, src := range srcs {
+					if src.Path != "" {
+						return nil, xerrors.Errorf("%s: depends on %s using path = \"%s\", which does not exist in the build directory - declare the crate as version or git dependency instead", name, dep.FullName(), src.Path)
+					}
+					if src.Git != "" {
+						sources[fmt.Sprintf("%q", src.Git)] = struct{}{}
+					}
+				}
+			}
+			for src := range sources {
+				patches = append(patches, fmt.Sprintf(`patch.%s.%s.path="%s"`, src, crate, tgt))
+			}
+		}
+		sort.Strings(patches)
+		for _, patch := range patches {
+			cargoFlags = append(cargoFlags, "--config", patch)
+		}
+	}
+
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], p.PreparationCommands...)
+
+	var featureFlags []string
+	if len(cfg.Features) > 0 {
+		featureFlags = []string{"--features", strings.Join(cfg.Features, ",")}
+	}
+	cargo := func(subcmd string, args ...string) []string {
+		res := []string{"cargo", subcmd}
+		if log.IsLevelEnabled(log.DebugLevel) {
+			res = append(res, "-v")
+		}
+		res = append(res, cargoFlags...)
+		return append(res, args...)
+	}
+
+	commands[PackageBuildPhasePull] = append(commands[PackageBuildPhasePull], cargo("fetch"))
+
+	if !cfg.DontLint {
+		lintCmd := cargo("clippy", "--all-targets")
+		lintCmd = append(lintCmd, featureFlags...)
+		lintCmd = append(lintCmd, "--", "-D", "warnings")
+		commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], lintCmd)
+	}
+	if !cfg.DontTest && !buildctx.DontTest {
+		commands[PackageBuildPhaseTest] = append(commands[PackageBuildPhaseTest], cargo("test", featureFlags...))
+	}
+
+	switch cfg.Packaging {
+	case RustBin:
+		buildCmd := cargo("build", "--profile", cfg.Profile)
+		buildCmd = append(buildCmd, featureFlags...)
+		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], buildCmd)
+
+		// cargo places the binaries alongside other build output - executable files at the top level of the profile dir are the binaries
+		commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], [][]string{
+			{"mkdir", "-p", "_pkg/bin"},
+			{"find", filepath.Join("target", cfg.ProfileDir()), "-maxdepth", "1", "-type", "f", "-perm", "-u+x", "-exec", "cp", "{}", "_pkg/bin/", ";"},
+			{"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "-C", "_pkg", "."},
+		}...)
+	case RustLib:
+		commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], []string{
+			"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "--exclude=./target", "--exclude=./_deps", ".",
+		})
+	}
+
+	return &packageBuild{
+		Commands: commands,
+	}, nil
+}
+
+// cargoManifest is the part of a Cargo.toml file we're interested in
+type cargoManifest struct {
+	Package struct {
+		Name string `toml:"name"`
+	} `toml:"package"`
+	Dependencies      map[string]toml.Primitive `toml:"dependencies"`
+	DevDependencies   map[string]toml.Primitive `toml:"dev-dependencies"`
+	BuildDependencies map[string]toml.Primitive `toml:"build-dependencies"`
+	Target            map[string]struct {
+		Dependencies      map[string]toml.Primitive `toml:"dependencies"`
+		DevDependencies   map[string]toml.Primitive `toml:"dev-dependencies"`
+		BuildDependencies map[string]toml.Primitive `toml:"build-dependencies"`
+	} `toml:"target"`
+}
+
+// parseCargoManifest parses the content of a Cargo.toml file
+func parseCargoManifest(manifest string) (*cargoManifest, toml.MetaData, error) {
+	var res cargoManifest
+	md, err := toml.Decode(manifest, &res)
+	if err != nil {
+		return nil, md, xerrors.Errorf("invalid Cargo.toml: %w", err)
+	}
+	return &res, md, nil
+}
+
+// cargoPackageName returns the crate name declared in the [package] section of a Cargo.toml file
+func cargoPackageName(manifest string) (string, error) {
+	mf, _, err := parseCargoManifest(manifest)
+	if err != nil {
+		return "", err
+	}
+	if mf.Package.Name == "" {
+		return "", xerrors.Errorf("Cargo.toml has no package name")
+	}
+	return mf.Package.Name, nil
+}
+
+// cargoDependencySource is where a Cargo.toml takes a dependency from. Dependencies without git or path come from a registry.
+type cargoDependencySource struct {
+	Git  string
+	Path string
+}
+
+// cargoDependencySources returns the sources of all declarations of a crate in the dependency tables of a Cargo.toml file,
+// including dev, build and target specific dependencies. Renamed dependencies are matched by their package key.
+func cargoDependencySources(manifest, crate string) ([]cargoDependencySource, error) {
+	mf, md, err := parseCargoManifest(manifest)
+	if err != nil {
+		return nil, err
 	}
 
-	transdep := p.GetTransitiveDependencies()
-	if len(transdep) > 0 {
-		commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{"mkdir", "_deps"})
+	tables := []map[string]toml.Primitive{mf.Dependencies, mf.DevDependencies, mf.BuildDependencies}
+	for _, tgt := range mf.Target {
+		tables = append(tables, tgt.Dependencies, tgt.DevDependencies, tgt.BuildDependencies)
+	}
 
-		for _, dep := range transdep {
-			if dep.Ephemeral {
-				continue
+	var res []cargoDependencySource
+	for _, deps := range tables {
+		for name, decl := range deps {
+			// dependencies are either a version requirement or a table
+			var dep struct {
+				Package string `toml:"package"`
+				Git     string `toml:"git"`
+				Path    string `toml:"path"`
 			}
-
-			builtpkg, ok := buildctx.LocalCache.Location(dep)
-			if !ok {
-				return nil, PkgNotBuiltErr{dep}
+			if md.PrimitiveDecode(decl, &dep) != nil {
+				var version string
+				err := md.PrimitiveDecode(decl, &version)
+				if err != nil {
+					return nil, xerrors.Errorf("invalid dependency %s in Cargo.toml: %w", name, err)
+				}
 			}
-
-			tgt := filepath.Join("_deps", p.BuildLayoutLocation(dep))
-			commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], [][]string{
-				{"mkdir", tgt},
-				{"tar", "xfz", builtpkg, "--no-same-owner", "-C", tgt},
-			}...)
-
-			if dep.Type != GoPackage {
-				continue
+			if dep.Package != "" {
+				name = dep.Package
 			}
-
-			if isGoWorkspace {
-				commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{"go", "work", "use", tgt})
-			} else {
-				commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{"sh", "-c", fmt.Sprintf("%s mod edit -replace $(cd %s; grep module go.mod | cut -d ' ' -f 2 | head -n1)=./%s", goCommand, tgt, tgt)})
+			if name != crate {
+				continue
 			}
+			res = append(res, cargoDependencySource{Git: dep.Git, Path: dep.Path})
 		}
 	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Git != res[j].Git {
+			return res[i].Git < res[j].Git
+		}
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
 
-	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], p.PreparationCommands...)
-	if cfg.Generate {
-		commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{goCommand, "generate", "-v", "./..."})
+// buildPython implements the build process for Python packages.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildPython(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	cfg, ok := p.Config.(PythonPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have Python config")
 	}
 
-	dlcmd := []string{goCommand, "mod", "download"}
-	if log.IsLevelEnabled(log.DebugLevel) {
-		dlcmd = append(dlcmd, "-x")
+	var isProject bool
+	for _, fn := range []string{"pyproject.toml", "setup.py"} {
+		if _, err := os.Stat(filepath.Join(wd, fn)); err == nil {
+			isProject = true
+			break
+		}
+	}
+	if !isProject {
+		return nil, xerrors.Errorf("can only build Python projects (missing pyproject.toml or setup.py file)")
 	}
-	commands[PackageBuildPhasePull] = append(commands[PackageBuildPhasePull], dlcmd)
 
-	if !cfg.DontCheckGoFmt {
-		commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], []string{"sh", "-c", `if [ ! $(go fmt ./... | wc -l) -eq 0 ]; then echo; echo; echo please gofmt your code; echo; echo; exit 1; fi`})
+	var (
+		commands = make(map[PackageBuildPhase][][]string)
+		// findLinks makes pip look for the wheels of dependencies before asking the package index
+		findLinks []string
+		depWheels []string
+	)
+	// The virtual env has access to the host's site packages, e.g. to use pytest or flake8 installed on the host
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], []string{"python3", "-m", "venv", "--system-site-packages", "_venv"})
+
+	unpackCmds, unpacked, err := p.unpackDependencies(buildctx, "_deps")
+	if err != nil {
+		return nil, err
 	}
-	if !cfg.DontLint {
-		if len(cfg.LintCommand) == 0 {
-			commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], []string{"golangci-lint", "run"})
-		} else {
-			commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], cfg.LintCommand)
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], unpackCmds...)
+	for _, dep := range unpacked {
+		if dep.Package.Type != PythonPackage {
+			continue
 		}
+		findLinks = append(findLinks, "--find-links", dep.Location)
+		depWheels = append(depWheels, shellQuote(dep.Location)+"/*.whl")
 	}
-	var reportCoverage testCoverageFunc
-	if !cfg.DontTest && !buildctx.DontTest {
-		testCommand := []string{goCommand, "test"}
-		if log.IsLevelEnabled(log.DebugLevel) {
-			testCommand = append(testCommand, "-v")
-		}
 
-		if buildctx.buildOptions.CoverageOutputPath != "" {
-			testCommand = append(testCommand, fmt.Sprintf("-coverprofile=%v", codecovComponentName(p.FullName())))
-		} else {
-			testCommand = append(testCommand, "-coverprofile=testcoverage.out")
-			reportCoverage = collectGoTestCoverage(filepath.Join(wd, "testcoverage.out"))
-		}
-		testCommand = append(testCommand, "./...")
+	commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], p.PreparationCommands...)
 
-		commands[PackageBuildPhaseTest] = append(commands[PackageBuildPhaseTest], testCommand)
+	pip := func(args ...string) []string {
+		res := []string{"_venv/bin/python", "-m", "pip"}
+		if log.IsLevelEnabled(log.DebugLevel) {
+			res = append(res, "-v")
+		}
+		return append(res, args...)
+	}
+	var buildIsolation []string
+	if len(cfg.BuildRequires) > 0 {
+		// with the build requirements installed upfront, building the wheel does not need access to the package index
+		commands[PackageBuildPhasePull] = append(commands[PackageBuildPhasePull], pip(append([]string{"install"}, cfg.BuildRequires...)...))
+		buildIsolation = []string{"--no-build-isolation"}
+	}
+	installCmd := pip("install")
+	installCmd = append(installCmd, findLinks...)
+	installCmd = append(installCmd, buildIsolation...)
+	if len(depWheels) > 0 {
+		// We install the wheels of dependencies explicitly so that pip does not prefer a version from the package index.
+		// The wheels' names are only known once extracted, hence the shell.
+		script := make([]string, 0, len(installCmd)+len(depWheels)+1)
+		for _, arg := range installCmd {
+			script = append(script, shellQuote(arg))
+		}
+		script = append(script, depWheels...)
+		script = append(script, ".")
+		installCmd = []string{"sh", "-c", strings.Join(script, " ")}
+	} else {
+		installCmd = append(installCmd, ".")
 	}
+	commands[PackageBuildPhasePull] = append(commands[PackageBuildPhasePull], installCmd)
 
-	var buildCmd []string
-	if len(cfg.BuildCommand) > 0 {
-		buildCmd = cfg.BuildCommand
-	} else if cfg.Packaging == GoApp {
-		buildCmd = []string{goCommand, "build"}
-		buildCmd = append(buildCmd, cfg.BuildFlags...)
-		buildCmd = append(buildCmd, ".")
+	if !cfg.DontLint {
+		var lintCmd []string
+		switch cfg.Linter {
+		case PythonLinterRuff:
+			lintCmd = []string{"_venv/bin/python", "-m", "ruff", "check", "--extend-exclude", "_venv,_deps", "."}
+		case PythonLinterFlake8:
+			lintCmd = []string{"_venv/bin/python", "-m", "flake8", "--extend-exclude", "_venv,_deps", "."}
+		}
+		commands[PackageBuildPhaseLint] = append(commands[PackageBuildPhaseLint], lintCmd)
 	}
-	if len(buildCmd) > 0 && cfg.Packaging != GoLibrary {
-		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], buildCmd)
+	if !cfg.DontTest && !buildctx.DontTest {
+		commands[PackageBuildPhaseTest] = append(commands[PackageBuildPhaseTest], []string{"_venv/bin/python", "-m", "pytest"})
 	}
 
-	commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], []string{"rm", "-rf", "_deps"})
+	buildCmd := pip("wheel", "--no-deps", "--wheel-dir", "_dist")
+	buildCmd = append(buildCmd, buildIsolation...)
+	buildCmd = append(buildCmd, ".")
+	commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], buildCmd)
+
 	commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], []string{
-		"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), ".",
+		"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "-C", "_dist", ".",
 	})
-	if !cfg.DontTest && !buildctx.DontTest {
-		commands[PackageBuildPhasePackage] = append(commands[PackageBuildPhasePackage], [][]string{
-			{"sh", "-c", fmt.Sprintf(`if [ -f "%v" ]; then cp -f %v %v; fi`, codecovComponentName(p.FullName()), codecovComponentName(p.FullName()), buildctx.buildOptions.CoverageOutputPath)},
-		}...)
-	}
 
 	return &packageBuild{
-		Commands:     commands,
-		TestCoverage: reportCoverage,
+		Commands: commands,
 	}, nil
 }
 
-func collectGoTestCoverage(covfile string) testCoverageFunc {
-	return func() (coverage, funcsWithoutTest, funcsWithTest int, err error) {
-		// We need to collect the coverage for all packages in the module.
-		// To that end we load the coverage file.
-		// The coverage file contains the coverage for all packages in the module.
-
-		cmd := exec.Command("go", "tool", "cover", "-func", covfile)
-		log.WithField("pwd", filepath.Dir(covfile)).WithField("covfile", covfile).Debug("collecting test coverage")
-		cmd.Dir = filepath.Dir(covfile)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			err = xerrors.Errorf("cannot collect test coverage: %w: %s", err, string(out))
-			return
-		}
-
-		coverage, funcsWithoutTest, funcsWithTest, err = parseGoCoverOutput(string(out))
-		return
-	}
-}
-
-func parseGoCoverOutput(input string) (coverage, funcsWithoutTest, funcsWithTest int, err error) {
-	// The output of the coverage tool looks like this:
-	// github.com/khulnasoft/nxpod/content_ws/pkg/contentws/contentws.go:33:	New		100.0%
-	lines := strings.Split(input, "\n")
-
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
-			continue
-		}
-		perc := strings.Trim(strings.TrimSpace(fields[2]), "%")
-		percF, err := strconv.ParseFloat(perc, 32)
-		if err != nil {
-			log.Warnf("cannot parse coverage percentage for line %s: %v", line, err)
-			continue
-		}
-		intCov := int(percF)
-		coverage += intCov
-		if intCov == 0 {
-			funcsWithoutTest++
-		} else {
-			funcsWithTest++
-		}
-	}
-
-	total := (funcsWithoutTest + funcsWithTest)
-	if total != 0 {
-		coverage = coverage / total
-	}
-	return
+// shellQuote quotes s for use as a single word in a POSIX shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
 // buildDocker implements the build process for Docker packages.
@@ -1405,6 +2660,25 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 		if err != nil {
 			return nil, err
 		}
+		if depimg == "" {
+			// The dependency exported its image rather than pushing it. We load that image and give it a name
+			// which depends on the dependency's version only.
+			depversion, err := dep.Version()
+			if err != nil {
+				return nil, err
+			}
+			depimg = dockerDependencyImageName(dep.FilesystemSafeName(), depversion)
+
+			builder := p.DockerBuilder()
+			loadcmd := []string{string(builder), "load", "-i", fn}
+			if builder == DockerBuilderBuildah {
+				loadcmd = []string{"buildah", "pull", "docker-archive:" + fn}
+			}
+			commands[PackageBuildPhasePrep] = append(commands[PackageBuildPhasePrep], [][]string{
+				loadcmd,
+				{string(builder), "tag", depversion, depimg},
+			}...)
+		}
 		imageDependencies[strings.ToUpper(strings.ReplaceAll(dep.FilesystemSafeName(), "-", "_"))] = depimg
 	}
 
@@ -1415,7 +2689,61 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 		return nil, err
 	}
 
-	buildcmd := []string{"docker", "build", "--pull", "-t", version}
+	builder := p.DockerBuilder()
+	if builder != DockerBuilderDocker && cfg.Backend == DockerBackendBuildx {
+		return nil, xerrors.Errorf("%s: the %s backend requires docker as builder, but the workspace uses %s", p.FullName(), cfg.Backend, builder)
+	}
+
+	var (
+		buildcmd    = []string{string(builder), "build", "--pull", "-t", version}
+		commitCache func() error
+	)
+	if cfg.Backend == DockerBackendBuildx {
+		buildcmd = []string{"docker", "buildx", "build", "--pull"}
+		if len(cfg.Image) == 0 {
+			// BuildKit pushes every tag, hence only exported images carry the version tag
+			buildcmd = append(buildcmd, "-t", version)
+		}
+		if len(cfg.Platforms) > 0 {
+			buildcmd = append(buildcmd, "--platform", strings.Join(cfg.Platforms, ","))
+		}
+		for _, secret := range cfg.Secrets {
+			buildcmd = append(buildcmd, "--secret", secret.BuildxFlag())
+		}
+		if fsc, ok := buildctx.LocalCache.(*FilesystemCache); ok {
+			// BuildKit's layer cache lives next to the build artifacts. Exporting to a local cache only ever adds to it,
+			// hence we export to a fresh directory and replace the previous cache once the build succeeded.
+			// The layer cache is local to this machine and not shared through the remote cache.
+			cacheDir := filepath.Join(fsc.Origin, "buildx", p.FilesystemSafeName())
+			buildcmd = append(buildcmd,
+				"--cache-from", fmt.Sprintf("type=local,src=%s", cacheDir),
+				"--cache-to", fmt.Sprintf("type=local,dest=%s.new,mode=max", cacheDir),
+			)
+			commitCache = func() error {
+				if _, err := os.Stat(cacheDir + ".new"); os.IsNotExist(err) {
+					return nil
+				}
+				err := os.RemoveAll(cacheDir)
+				if err != nil {
+					return xerrors.Errorf("cannot replace buildx cache: %w", err)
+				}
+				err = os.Rename(cacheDir+".new", cacheDir)
+				if err != nil {
+					return xerrors.Errorf("cannot replace buildx cache: %w", err)
+				}
+				return nil
+			}
+		}
+		if len(cfg.Image) == 0 {
+			buildcmd = append(buildcmd, "--output", fmt.Sprintf("type=oci,dest=%s", strings.TrimSuffix(result, ".gz")))
+		} else {
+			// multi-platform images cannot be loaded into the Docker daemon, hence we push straight from BuildKit
+			buildcmd = append(buildcmd,
+				"--output", fmt.Sprintf(`type=image,"name=%s",push=true`, strings.Join(cfg.Image, ",")),
+				"--metadata-file", dockerBuildxMetadataFile,
+			)
+		}
+	}
 	for arg, val := range cfg.BuildArgs {
 		buildcmd = append(buildcmd, "--build-arg", fmt.Sprintf("%s=%s", arg, val))
 	}
@@ -1434,21 +2762,30 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 	buildcmd = append(buildcmd, ".")
 	commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], buildcmd)
 
-	if len(cfg.Image) == 0 {
+	if len(cfg.Image) == 0 && cfg.Backend != DockerBackendBuildx {
 		// we don't push the image, let's export it
 		ef := strings.TrimSuffix(result, ".gz")
-		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], [][]string{
-			{"docker", "save", "-o", ef, version},
-		}...)
+		var savecmd []string
+		switch builder {
+		case DockerBuilderBuildah:
+			savecmd = []string{"buildah", "push", version, fmt.Sprintf("docker-archive:%s:%s", ef, version)}
+		case DockerBuilderPodman:
+			savecmd = []string{"podman", "save", "--format", "docker-archive", "-o", ef, version}
+		default:
+			savecmd = []string{"docker", "save", "-o", ef, version}
+		}
+		// podman and buildah export the same archive format as docker save
+		commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], savecmd)
 	}
 
 	res = &packageBuild{
-		Commands: commands,
+		Commands:   commands,
+		AfterBuild: commitCache,
 	}
 
 	var pkgCommands [][]string
 	if len(cfg.Image) == 0 {
-		// We've already built the build artifact by exporting the archive using "docker save"
+		// We've already built the build artifact by exporting the archive using "docker save", or as OCI layout using buildx.
 		// At the very least we need to add the provenance bundle to that archive.
 		ef := strings.TrimSuffix(result, ".gz")
 		res.PostBuild = dockerExportPostBuild(wd, ef)
@@ -1461,11 +2798,19 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 		pkgcmds = append(pkgcmds, []string{compressor, ef})
 		commands[PackageBuildPhasePackage] = pkgcmds
 	} else if len(cfg.Image) > 0 {
+		// We push during the build phase so that the registry digests are known when we compute the provenance subjects
 		for _, img := range cfg.Image {
-			pkgCommands = append(pkgCommands, [][]string{
-				{"docker", "tag", version, img},
-				{"docker", "push", img},
-			}...)
+			if cfg.Backend != DockerBackendBuildx {
+				pushcmd := []string{string(builder), "push", img}
+				if builder != DockerBuilderDocker {
+					pushcmd = []string{string(builder), "push", "--digestfile", ".digest", img}
+				}
+				commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], [][]string{
+					{string(builder), "tag", version, img},
+					pushcmd,
+				}...)
+			}
+			commands[PackageBuildPhaseBuild] = append(commands[PackageBuildPhaseBuild], dockerDigestCommand(builder, cfg.Backend, img))
 		}
 
 		// We pushed the image which means we won't export it. We still need to place a marker the build cache.
@@ -1485,7 +2830,7 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 		}
 		pkgCommands = append(pkgCommands, []string{"sh", "-c", fmt.Sprintf("echo %s | base64 -d > %s", base64.StdEncoding.EncodeToString(consts), dockerMetadataFile)})
 
-		archiveCmd := []string{"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "./" + dockerImageNamesFiles, "./" + dockerMetadataFile}
+		archiveCmd := []string{"tar", "cf", result, fmt.Sprintf("--use-compress-program=%v", compressor), "./" + dockerImageNamesFiles, "./" + dockerImageDigestsFile, "./" + dockerMetadataFile}
 		if p.C.W.Provenance.Enabled {
 			archiveCmd = append(archiveCmd, "./"+provenanceBundleFilename)
 		}
@@ -1498,33 +2843,24 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 					err = xerrors.Errorf("provenance get subjects: %w", err)
 				}
 			}()
-			out, err := exec.Command("docker", "inspect", version).CombinedOutput()
-			if err != nil {
-				return nil, xerrors.Errorf("cannot determine ID of the image we just built")
-			}
-			var inspectRes []struct {
-				ID string `json:"Id"`
-			}
-			err = json.Unmarshal(out, &inspectRes)
+			refs, err := readDockerImageDigests(filepath.Join(wd, dockerImageDigestsFile))
 			if err != nil {
-				return nil, xerrors.Errorf("cannot unmarshal Docker inspect response \"%s\": %w", string(out), err)
-			}
-			if len(inspectRes) == 0 {
-				return nil, xerrors.Errorf("did not receive a proper Docker inspect response")
-			}
-			segs := strings.Split(inspectRes[0].ID, ":")
-			if len(segs) != 2 {
-				return nil, xerrors.Errorf("docker inspect returned invalid digest: %s", inspectRes[0].ID)
+				return nil, err
 			}
-			digest := in_toto.DigestSet{
-				segs[0]: segs[1],
+			if len(refs) != len(cfg.Image) {
+				return nil, xerrors.Errorf("found %d image digests for %d images", len(refs), len(cfg.Image))
 			}
 
 			res = make([]in_toto.Subject, 0, len(cfg.Image))
-			for _, tag := range cfg.Image {
+			for i, tag := range cfg.Image {
+				_, digest, _ := strings.Cut(refs[i], "@")
+				segs := strings.Split(digest, ":")
+				if len(segs) != 2 {
+					return nil, xerrors.Errorf("invalid image digest: %s", refs[i])
+				}
 				res = append(res, in_toto.Subject{
 					Name:   tag,
-					Digest: digest,
+					Digest: in_toto.DigestSet{segs[0]: segs[1]},
 				})
 			}
 
@@ -1535,6 +2871,55 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 	return res, nil
 }
 
+// dockerImageRepository returns the repository of an image reference, i.e. the reference without tag or digest.
+// Images on Docker Hub are named the way the Docker CLI reports them, e.g. docker.io/library/alpine becomes alpine.
+func dockerImageRepository(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	if strings.HasPrefix(ref, "docker.io/") {
+		ref = strings.TrimPrefix(strings.TrimPrefix(ref, "docker.io/"), "library/")
+	}
+	return ref
+}
+
+// dockerDigestCommand returns the command which appends the digest-pinned reference of a pushed image to the image digests file
+func dockerDigestCommand(builder DockerBuilder, backend DockerBackend, img string) []string {
+	repo := dockerImageRepository(img)
+
+	var resolve string
+	switch {
+	case backend == DockerBackendBuildx:
+		resolve = fmt.Sprintf(`d=$(sed -n 's/.*"containerimage.digest": *"\([^"]*\)".*/\1/p' %s)`, dockerBuildxMetadataFile)
+	case builder == DockerBuilderDocker:
+		resolve = fmt.Sprintf(`d=$(docker inspect --format '{{range .RepoDigests}}{{println .}}{{end}}' %s | awk -v p='%s@' 'index($0, p) == 1 { print substr($0, length(p) + 1); exit }')`, img, repo)
+	default:
+		// podman and buildah push with --digestfile
+		resolve = `d=$(cat .digest)`
+	}
+	return []string{"sh", "-c", fmt.Sprintf(`%s; [ -n "$d" ] || { echo "cannot determine digest of %s" >&2; exit 1; }; echo "%s@$d" >> %s`, resolve, img, repo, dockerImageDigestsFile)}
+}
+
+// readDockerImageDigests reads the digest-pinned image references of an image digests file
+func readDockerImageDigests(fn string) ([]string, error) {
+	fc, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read image digests: %w", err)
+	}
+	var res []string
+	for _, l := range strings.Split(string(fc), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
 func dockerExportPostBuild(builddir, result string) func(sources fileset) (subj []in_toto.Subject, absResultDir string, err error) {
 	return func(sources fileset) (subj []in_toto.Subject, absResultDir string, err error) {
 		f, err := os.Open(result)
@@ -1573,8 +2958,15 @@ func dockerExportPostBuild(builddir, result string) func(sources fileset) (subj
 	}
 }
 
+// dockerDependencyImageName returns the name under which we load the exported image of a docker package
+// when building its dependants.
+func dockerDependencyImageName(fsSafeName, version string) string {
+	return fmt.Sprintf("turbocache/%s:%s", strings.ToLower(fsSafeName), version)
+}
+
 // extractImageNameFromCache extracts the Docker image name of a previously built package
-// from the cache tar.gz file of that package.
+// from the cache tar.gz file of that package. If known, the name is pinned to the digest of the pushed image.
+// Returns an empty name if the package exported its image.
 func extractImageNameFromCache(pkgName, cacheBundleFN string) (imgname string, err error) {
 	defer func() {
 		if err != nil {
@@ -1588,13 +2980,22 @@ func extractImageNameFromCache(pkgName, cacheBundleFN string) (imgname string, e
 	}
 	defer f.Close()
 
-	gzin, err := gzip.NewReader(f)
-	if err != nil {
-		return "", err
+	// the artifact name does not tell whether it's compressed, hence we look for the gzip magic number
+	var (
+		bf                 = bufio.NewReader(f)
+		in       io.Reader = bf
+		magic, _           = bf.Peek(2)
+	)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzin, err := gzip.NewReader(bf)
+		if err != nil {
+			return "", err
+		}
+		defer gzin.Close()
+		in = gzin
 	}
-	defer gzin.Close()
 
-	tarin := tar.NewReader(gzin)
+	tarin := tar.NewReader(in)
 	for {
 		hdr, err := tarin.Next()
 		if errors.Is(err, io.EOF) {
@@ -1607,24 +3008,31 @@ func extractImageNameFromCache(pkgName, cacheBundleFN string) (imgname string, e
 		if hdr.Typeflag != tar.TypeReg {
 			continue
 		}
-		if filepath.Base(hdr.Name) != dockerImageNamesFiles {
+		name := filepath.Base(hdr.Name)
+		if name != dockerImageNamesFiles && name != dockerImageDigestsFile {
 			continue
 		}
 
-		imgnames := make([]byte, hdr.Size)
-		n, err := io.ReadFull(tarin, imgnames)
+		content := make([]byte, hdr.Size)
+		n, err := io.ReadFull(tarin, content)
 		if err != nil {
 			return "", err
 		}
 		if int64(n) != hdr.Size {
-			return "", fmt.Errorf("cannot read %s from cache: %w", dockerImageNamesFiles, io.ErrShortBuffer)
+			return "", fmt.Errorf("cannot read %s from cache: %w", name, io.ErrShortBuffer)
 		}
 
-		lines := strings.Split(string(imgnames), "\n")
-		return lines[0], nil
+		lines := strings.Split(string(content), "\n")
+		if name == dockerImageDigestsFile && lines[0] != "" {
+			// digest-pinned references take precedence over the names
+			return lines[0], nil
+		}
+		if imgname == "" {
+			imgname = lines[0]
+		}
 	}
 
-	return "", nil
+	return imgname, nil
 }
 
 // Helper function to get compression arg based on DontCompress setting
@@ -1635,6 +3043,28 @@ func getCompressionArg(ctx *buildContext) string {
 	return fmt.Sprintf("--use-compress-program=%v", compressor)
 }
 
+// buildNamedOutput implements the build process for named outputs: the files of the output are selected
+// from the build artifact of the package the output belongs to
+func (p *Package) buildNamedOutput(buildctx *buildContext, result string) (res *packageBuild, err error) {
+	fn, exists := buildctx.LocalCache.Location(p.outputOf)
+	if !exists {
+		return nil, PkgNotBuiltErr{p.outputOf}
+	}
+
+	tarArgs := []string{"tar", "cf", result}
+	if compressArg := getCompressionArg(buildctx); compressArg != "" {
+		tarArgs = append(tarArgs, compressArg)
+	}
+	tarArgs = append(tarArgs, p.artifactContent()...)
+
+	return &packageBuild{
+		Commands: map[PackageBuildPhase][][]string{
+			PackageBuildPhasePrep:    {{"tar", "xf", fn, "--no-same-owner"}},
+			PackageBuildPhasePackage: {tarArgs},
+		},
+	}, nil
+}
+
 // Update buildGeneric to use compression arg helper
 func (p *Package) buildGeneric(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
 	cfg, ok := p.Config.(GenericPkgConfig)
@@ -1642,8 +3072,8 @@ func (p *Package) buildGeneric(buildctx *buildContext, wd, result string) (res *
 		return nil, xerrors.Errorf("package should have generic config")
 	}
 
-	// shortcut: no command == empty package
-	if len(cfg.Commands) == 0 && len(cfg.Test) == 0 {
+	// shortcut: no command == empty package, unless the outputs select some of the sources
+	if len(cfg.Commands) == 0 && len(cfg.Test) == 0 && len(p.Outputs) == 0 {
 		log.WithField("package", p.FullName()).Debug("package has no commands nor test - creating empty tar")
 
 		compressArg := getCompressionArg(buildctx)
@@ -1695,7 +3125,7 @@ func (p *Package) buildGeneric(buildctx *buildContext, wd, result string) (res *
 	if compressArg != "" {
 		tarArgs = append(tarArgs, compressArg)
 	}
-	tarArgs = append(tarArgs, ".")
+	tarArgs = append(tarArgs, p.artifactContent()...)
 
 	return &packageBuild{
 		Commands: map[PackageBuildPhase][][]string{
@@ -1705,18 +3135,33 @@ func (p *Package) buildGeneric(buildctx *buildContext, wd, result string) (res *
 	}, nil
 }
 
-func executeCommandsForPackage(buildctx *buildContext, p *Package, wd string, commands [][]string) error {
+func executeCommandsForPackage(buildctx *buildContext, p *Package, cg *packageCgroup, wd string, phase PackageBuildPhase, commands [][]string) (err error) {
 	if len(commands) == 0 {
 		return nil
 	}
+
+	isolation := sandboxIsolation{
+		Filesystem: buildctx.SandboxedExecution,
+		Network:    !p.Network.AllowedDuring(phase),
+	}
+	if isolation.Network {
+		defer func() {
+			if err != nil {
+				err = networkIsolationError(p, phase, err)
+			}
+		}()
+	}
+
 	if buildctx.JailedExecution {
-		return executeCommandsForPackageSafe(buildctx, p, wd, commands)
+		return executeCommandsForPackageSafe(buildctx, p, wd, commands, isolation, cg)
+	}
+	if isolation.Filesystem || isolation.Network {
+		return executeCommandsForPackageSandboxed(buildctx, p, wd, commands, isolation, cg)
 	}
 
-	env := append(os.Environ(), p.Environment...)
-	env = append(env, fmt.Sprintf("TURBOCACHE_WORKSPACE_ROOT=%s", p.C.W.Origin))
+	env := p.buildEnvironment(wd)
 	for _, cmd := range commands {
-		err := run(buildctx.Reporter, p, env, wd, cmd[0], cmd[1:]...)
+		err := runInCgroup(buildctx.Reporter, p, cg, env, wd, cmd[0], cmd[1:]...)
 		if err != nil {
 			return err
 		}
@@ -1724,7 +3169,127 @@ func executeCommandsForPackage(buildctx *buildContext, p *Package, wd string, co
 	return nil
 }
 
+// networkIsolationError explains that a phase which failed ran without network access, e.g. because it tried to connect out
+func networkIsolationError(p *Package, phase PackageBuildPhase, err error) error {
+	return xerrors.Errorf("%s phase failed without network access (package sets network: %s): %w", phase, p.Network, err)
+}
+
+// sandboxIsolation configures what a sandbox isolates the build commands from
+type sandboxIsolation struct {
+	// Filesystem makes everything but the build directory and cache read-only, and provides a private /tmp
+	Filesystem bool `json:"filesystem"`
+	// Network runs the build commands in their own network namespace
+	Network bool `json:"network"`
+}
+
+// packageResourceUsage describes the resources a package build used
+type packageResourceUsage struct {
+	PeakMemoryBytes uint64
+	CPUTime         time.Duration
+}
+
+// buildEnvironment returns the environment the build commands of this package run with in the build directory wd.
+// In hermetic mode only the passEnv allowlist, the envdeps and the package's own env reach the build.
+func (p *Package) buildEnvironment(wd string) []string {
+	hermetic := p.C.W.Hermetic
+	env := hermetic.FilterEnvironment(os.Environ())
+	if hermetic.Enabled {
+		for _, name := range p.EnvDependencies {
+			if val, ok := os.LookupEnv(name); ok {
+				env = append(env, fmt.Sprintf("%s=%s", name, val))
+			}
+		}
+	}
+	if p.Type == GoPackage {
+		env = append(env, p.goEnvironment(wd)...)
+	}
+	env = append(env, p.Environment...)
+	env = append(env, fmt.Sprintf("TURBOCACHE_WORKSPACE_ROOT=%s", p.C.W.Origin))
+	return env
+}
+
+// goEnvironment returns the environment variables which configure the Go toolchain for Go package builds in the build directory wd
+func (p *Package) goEnvironment(wd string) (env []string) {
+	cfg, ok := p.Config.(GoPkgConfig)
+	if !ok {
+		return nil
+	}
+
+	var (
+		caches  = p.C.W.GoCaches()
+		offline bool
+	)
+	env = append(env, "GOCACHE="+caches.Build)
+	if cfg.Packaging == GoModCache {
+		// the module cache is what this package produces, hence it must not be shared.
+		// We download modules from go.mod files spread across the build directory and don't want go.work to interfere.
+		env = append(env, "GOMODCACHE="+filepath.Join(wd, goModCacheDir), "GOWORK=off")
+	} else if dep := p.goModCacheDependency(); dep != nil {
+		env = append(env, "GOMODCACHE="+filepath.Join(wd, "_deps", p.BuildLayoutLocation(dep)))
+		// go.work does not support -mod=mod, and syncs go.work.sum anyways
+		if _, err := os.Stat(filepath.Join(p.C.W.Origin, "go.work")); os.IsNotExist(err) {
+			env = append(env, "GOFLAGS="+strings.Join(append(p.hostGoFlags(), "-mod=mod"), " "))
+		}
+		offline = true
+	} else {
+		env = append(env, "GOMODCACHE="+caches.Module)
+	}
+
+	if tc := p.GoToolchain(); tc != "" {
+		// Without +auto the go command uses exactly this toolchain, i.e. the one the version manifest records,
+		// rather than the newer of the local toolchain and the go.mod directives. It runs a binary of that name
+		// from the PATH, e.g. one installed using golang.org/dl, or downloads the toolchain.
+		env = append(env, "GOTOOLCHAIN="+tc)
+	}
+
+	proxy := os.Getenv("GOPROXY")
+	if offline {
+		proxy = "off"
+	} else if proxy == "" {
+		proxy = "https://proxy.golang.org,direct"
+	}
+	if cache := os.Getenv(EnvvarGoToolchainCache); cache != "" {
+		env = append(env, fmt.Sprintf("GOPROXY=file://%s,%s", cache, proxy))
+	} else if offline {
+		env = append(env, "GOPROXY=off")
+	}
+	return env
+}
+
+// hostGoFlags returns the GOFLAGS which reach the build from the host environment, but for -mod
+func (p *Package) hostGoFlags() []string {
+	var res []string
+	for _, kv := range p.C.W.Hermetic.FilterEnvironment(os.Environ()) {
+		val, ok := strings.CutPrefix(kv, "GOFLAGS=")
+		if !ok {
+			continue
+		}
+		for _, flag := range strings.Fields(val) {
+			if strings.HasPrefix(flag, "-mod=") {
+				continue
+			}
+			res = append(res, flag)
+		}
+	}
+	return res
+}
+
+// goModCacheDependency returns the modcache package this package builds against, or nil if there is none
+func (p *Package) goModCacheDependency() *Package {
+	for _, dep := range p.GetTransitiveDependencies() {
+		if isGoModCache(dep) && !dep.Ephemeral {
+			return dep
+		}
+	}
+	return nil
+}
+
 func run(rep Reporter, p *Package, env []string, cwd, name string, args ...string) error {
+	return runInCgroup(rep, p, nil, env, cwd, name, args...)
+}
+
+// runInCgroup runs a command like run does, but starts it in the package cgroup if there is one
+func runInCgroup(rep Reporter, p *Package, cg *packageCgroup, env []string, cwd, name string, args ...string) error {
 	log.WithField("package", p.FullName()).WithField("command", strings.Join(append([]string{name}, args...), " ")).Debug("running")
 
 	cmd := exec.Command(name, args...)
@@ -1732,6 +3297,7 @@ func run(rep Reporter, p *Package, env []string, cwd, name string, args ...strin
 	cmd.Stderr = &reporterStream{R: rep, P: p, IsErr: true}
 	cmd.Dir = cwd
 	cmd.Env = env
+	cg.Apply(cmd)
 	err := cmd.Run()
 
 	if err != nil {
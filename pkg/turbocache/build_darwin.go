@@ -25,6 +25,33 @@ func checkForCpCompatibility() error {
 	return fmt.Errorf("turbocache requires a GNU-compatible cp. Please install using `brew install coreutils`; make sure you update your PATH after installing.")
 }
 
-func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string, commands [][]string) error {
+func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string, commands [][]string, isolation sandboxIsolation, cg *packageCgroup) error {
 	return fmt.Errorf("not implemented")
 }
+
+func executeCommandsForPackageSandboxed(buildctx *buildContext, p *Package, wd string, commands [][]string, isolation sandboxIsolation, cg *packageCgroup) error {
+	return fmt.Errorf("sandboxed execution and network isolation are only supported on Linux")
+}
+
+// RunSandbox is only supported on Linux
+func RunSandbox(specFN string) error {
+	return fmt.Errorf("not implemented")
+}
+
+type cgroupManager struct{}
+
+func newCgroupManager(parent string) (*cgroupManager, error) {
+	return nil, fmt.Errorf("resource limits are only supported on Linux")
+}
+
+type packageCgroup struct{}
+
+func (m *cgroupManager) NewPackageCgroup(p *Package, buildID string) (*packageCgroup, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (cg *packageCgroup) Apply(cmd *exec.Cmd) {}
+
+func (cg *packageCgroup) Close() (packageResourceUsage, error) {
+	return packageResourceUsage{}, nil
+}
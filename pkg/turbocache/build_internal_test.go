@@ -1,6 +1,13 @@
 package turbocache
 
 import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -28,9 +35,10 @@ func TestParseGoCoverOutput(t *testing.T) {
 			github.com/khulnasoft/turbocache/store.go:178:                    Delete                          100.0%
 			github.com/khulnasoft/turbocache/store.go:183:                    Scan                            80.0%
 			github.com/khulnasoft/turbocache/store.go:194:                    Close                           0.0%
-			github.com/khulnasoft/turbocache/store.go:206:                    Upsert                          0.0%`,
+			github.com/khulnasoft/turbocache/store.go:206:                    Upsert                          0.0%
+			total:                                                          (statements)                    71.4%`,
 			Expectation: Expectation{
-				Coverage:         63,
+				Coverage:         71,
 				FuncsWithoutTest: 2,
 				FuncsWithTest:    4,
 			},
@@ -53,3 +61,610 @@ func TestParseGoCoverOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestCargoPackageName(t *testing.T) {
+	type Expectation struct {
+		Name  string
+		Error string
+	}
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation Expectation
+	}{
+		{
+			Name:        "valid",
+			Input:       "[package]\nname = \"foo-bar\"\nversion = \"0.1.0\"\n",
+			Expectation: Expectation{Name: "foo-bar"},
+		},
+		{
+			Name:        "single quotes and comments",
+			Input:       "[package] # the crate\nname='foo' # name\n",
+			Expectation: Expectation{Name: "foo"},
+		},
+		{
+			Name:        "name outside package section",
+			Input:       "[lib]\nname = \"notthis\"\n\n[package]\nversion = \"0.1.0\"\nname = \"foo\"\n",
+			Expectation: Expectation{Name: "foo"},
+		},
+		{
+			Name:        "dotted keys",
+			Input:       "package.name = \"foo\"\npackage.description = \"\"\"\n[package]\nname = \"notthis\"\n\"\"\"\n",
+			Expectation: Expectation{Name: "foo"},
+		},
+		{
+			Name:        "no package section",
+			Input:       "[workspace]\nmembers = [\"foo\"]\n",
+			Expectation: Expectation{Error: "Cargo.toml has no package name"},
+		},
+		{
+			Name:        "unquoted name",
+			Input:       "[package]\nname = foo\n",
+			Expectation: Expectation{Error: "invalid Cargo.toml"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var act Expectation
+
+			var err error
+			act.Name, err = cargoPackageName(test.Input)
+			if err != nil {
+				// we only compare the beginning of the error, as the parser's messages are not ours
+				act.Error, _, _ = strings.Cut(err.Error(), ":")
+			}
+
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("cargoPackageName() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCargoDependencySources(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation []cargoDependencySource
+		Error       bool
+	}{
+		{
+			Name:        "registry",
+			Input:       "[dependencies]\ngreet = \"0.1\"\nother = { version = \"1\" }\n",
+			Expectation: []cargoDependencySource{{}},
+		},
+		{
+			Name:        "git and path",
+			Input:       "[dependencies]\ngreet = { git = \"https://example.com/greet.git\", branch = \"main\" }\n\n[dev-dependencies]\ngreet = { path = '../greet' }\n",
+			Expectation: []cargoDependencySource{{Path: "../greet"}, {Git: "https://example.com/greet.git"}},
+		},
+		{
+			Name:        "dependency table",
+			Input:       "[target.'cfg(unix)'.build-dependencies.greet]\ngit = \"https://example.com/greet.git\" # upstream\n\n[dependencies]\nserde = \"1\"\n",
+			Expectation: []cargoDependencySource{{Git: "https://example.com/greet.git"}},
+		},
+		{
+			Name:        "quoted dotted target",
+			Input:       "[target.'cfg(target_os = \"linux\")'.dependencies]\ngreet = { path = \"../greet\" }\n",
+			Expectation: []cargoDependencySource{{Path: "../greet"}},
+		},
+		{
+			Name:        "values with # and =",
+			Input:       "[dependencies]\ngreet = { version = \"=0.1\", path = \"../dir#1/a=b\" } # a comment = here\n",
+			Expectation: []cargoDependencySource{{Path: "../dir#1/a=b"}},
+		},
+		{
+			Name:        "multi-line table",
+			Input:       "[dependencies.greet]\nfeatures = [\n  \"a\",\n  \"b\",\n]\npath = \"../greet\"\n",
+			Expectation: []cargoDependencySource{{Path: "../greet"}},
+		},
+		{
+			Name:        "renamed",
+			Input:       "[dependencies]\nhello = { package = \"greet\", path = \"../greet\" }\ngreet-macros = \"0.1\"\n",
+			Expectation: []cargoDependencySource{{Path: "../greet"}},
+		},
+		{
+			Name:  "not a dependency",
+			Input: "[package]\nname = \"greet\"\n\n[features]\ngreet = []\n",
+		},
+		{
+			Name:  "invalid",
+			Input: "[dependencies]\ngreet = { path = \"../greet\"\n",
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act, err := cargoDependencySources(test.Input, "greet")
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected error, got %v", act)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("cargoDependencySources() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBuildRust(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Manifest    string
+		Expectation []string
+		Error       bool
+	}{
+		{
+			Name:     "registry and git dependencies",
+			Manifest: "[package]\nname = \"app\"\n\n[dependencies]\ngreet = { git = \"https://example.com/greet.git\" }\nutil = \"0.1\"\n",
+			Expectation: []string{"cargo", "fetch",
+				"--config", `patch."https://example.com/greet.git".greet.path="_deps/comp--greet"`,
+				"--config", `patch.crates-io.greet.path="_deps/comp--greet"`,
+				"--config", `patch.crates-io.util.path="_deps/comp--util"`,
+			},
+		},
+		{
+			Name:     "path dependency",
+			Manifest: "[package]\nname = \"app\"\n\n[dependencies]\ngreet = { path = \"../greet\" }\n",
+			Error:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			cache, err := NewFilesystemCache(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			comp := &Component{W: &Workspace{}, Name: "comp"}
+			lib := func(name string) *Package {
+				dir := t.TempDir()
+				err := os.WriteFile(filepath.Join(dir, "Cargo.toml"), []byte("[package]\nname = \""+name+"\"\n"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(filepath.Join(cache.Origin, name+".tar.gz"), nil, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return &Package{
+					C:               &Component{W: comp.W, Name: comp.Name, Origin: dir},
+					PackageInternal: PackageInternal{Name: name, Type: RustPackage},
+					Config:          RustPkgConfig{Packaging: RustLib},
+					dependencies:    []*Package{},
+					versionCache:    name,
+				}
+			}
+
+			wd := t.TempDir()
+			err = os.WriteFile(filepath.Join(wd, "Cargo.toml"), []byte(test.Manifest), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkg := &Package{
+				C:               comp,
+				PackageInternal: PackageInternal{Name: "app", Type: RustPackage},
+				Config:          RustPkgConfig{Packaging: RustBin, Profile: "release", DontTest: true, DontLint: true},
+				dependencies:    []*Package{lib("greet"), lib("util")},
+			}
+
+			bld, err := pkg.buildRust(&buildContext{buildOptions: buildOptions{LocalCache: cache}}, wd, "result.tar.gz")
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected error, got %v", bld.Commands)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([][]string{test.Expectation}, bld.Commands[PackageBuildPhasePull]); diff != "" {
+				t.Errorf("pull commands mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPatchJSDependencies(t *testing.T) {
+	localDeps := map[string]string{"@ws/lib": "file:/cache/lib.tar.gz"}
+	tests := []struct {
+		Name        string
+		PM          JSPackageManager
+		Input       string
+		Expectation string
+	}{
+		{
+			Name:        "npm",
+			PM:          JSPackageManagerNPM,
+			Input:       `{"dependencies":{"@ws/lib":"^1.0.0","left-pad":"1.3.0"},"devDependencies":{"@ws/lib":"*"}}`,
+			Expectation: `{"dependencies":{"@ws/lib":"file:/cache/lib.tar.gz","left-pad":"1.3.0"},"devDependencies":{"@ws/lib":"file:/cache/lib.tar.gz"},"overrides":{"@ws/lib":"file:/cache/lib.tar.gz"}}`,
+		},
+		{
+			Name:        "pnpm keeps existing overrides",
+			PM:          JSPackageManagerPNPM,
+			Input:       `{"dependencies":{"@ws/lib":"workspace:*"},"pnpm":{"overrides":{"foo":"1.0.0"}}}`,
+			Expectation: `{"dependencies":{"@ws/lib":"file:/cache/lib.tar.gz"},"pnpm":{"overrides":{"@ws/lib":"file:/cache/lib.tar.gz","foo":"1.0.0"}}}`,
+		},
+		{
+			Name:        "yarn berry",
+			PM:          jsPackageManagerYarnBerry,
+			Input:       `{"dependencies":{"@ws/lib":"workspace:^"}}`,
+			Expectation: `{"dependencies":{"@ws/lib":"file:/cache/lib.tar.gz"},"resolutions":{"@ws/lib":"file:/cache/lib.tar.gz"}}`,
+		},
+		{
+			Name:        "transitive only",
+			PM:          JSPackageManagerNPM,
+			Input:       `{}`,
+			Expectation: `{"overrides":{"@ws/lib":"file:/cache/lib.tar.gz"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var pkgjson map[string]interface{}
+			err := json.Unmarshal([]byte(test.Input), &pkgjson)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = patchJSDependencies(pkgjson, localDeps, test.PM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			act, err := json.Marshal(pkgjson)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.Expectation, string(act)); diff != "" {
+				t.Errorf("patchJSDependencies() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsYarnBerry(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Files       map[string]string
+		Expectation bool
+	}{
+		{
+			Name:        "yarn 1 lockfile",
+			Files:       map[string]string{"yarn.lock": "# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.\n# yarn lockfile v1\n"},
+			Expectation: false,
+		},
+		{
+			Name:        "yarn berry lockfile",
+			Files:       map[string]string{"yarn.lock": "# This file is generated by running \"yarn install\" inside your project.\n\n__metadata:\n  version: 8\n"},
+			Expectation: true,
+		},
+		{
+			Name:        "yarnPath",
+			Files:       map[string]string{".yarnrc.yml": "nodeLinker: node-modules\nyarnPath: .yarn/releases/yarn-4.5.0.cjs\n"},
+			Expectation: true,
+		},
+		{
+			Name:        "yarnrc without yarnPath",
+			Files:       map[string]string{".yarnrc.yml": "nodeLinker: node-modules\n"},
+			Expectation: false,
+		},
+		{
+			Name:        "no files",
+			Expectation: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			for fn, content := range test.Files {
+				err := os.WriteFile(filepath.Join(dir, fn), []byte(content), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if act := isYarnBerry(dir); act != test.Expectation {
+				t.Errorf("isYarnBerry() = %v, expected %v", act, test.Expectation)
+			}
+		})
+	}
+}
+
+func TestDockerImageRepository(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation string
+	}{
+		{"alpine", "alpine"},
+		{"alpine:3.20", "alpine"},
+		{"docker.io/library/alpine:3.20", "alpine"},
+		{"docker.io/khulnasoft/turbocache:latest", "khulnasoft/turbocache"},
+		{"localhost:5000/foo/bar:v1", "localhost:5000/foo/bar"},
+		{"localhost:5000/foo/bar", "localhost:5000/foo/bar"},
+		{"eu.gcr.io/foo/bar@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "eu.gcr.io/foo/bar"},
+	}
+
+	for _, test := range tests {
+		if act := dockerImageRepository(test.Input); act != test.Expectation {
+			t.Errorf("dockerImageRepository(%q) = %q, expected %q", test.Input, act, test.Expectation)
+		}
+	}
+}
+
+func TestResolveOutputs(t *testing.T) {
+	files := []string{"main.go", "app", "bin/linux/app", "bin/darwin/app", "_deps/lib/lib.go", outputListFilename}
+
+	tests := []struct {
+		Name        string
+		Type        PackageType
+		Outputs     []string
+		Expectation []string
+		Error       bool
+	}{
+		{
+			Name:        "single file",
+			Outputs:     []string{"app"},
+			Expectation: []string{"/app"},
+		},
+		{
+			Name:        "directory",
+			Outputs:     []string{"bin"},
+			Expectation: []string{"/bin/darwin/app", "/bin/linux/app"},
+		},
+		{
+			Name:        "doublestar",
+			Outputs:     []string{"**/app"},
+			Expectation: []string{"/app", "/bin/darwin/app", "/bin/linux/app"},
+		},
+		{
+			Name:        "glob",
+			Outputs:     []string{"bin/*/app", "*.go"},
+			Expectation: []string{"/bin/darwin/app", "/bin/linux/app", "/main.go"},
+		},
+		{
+			Name:        "go dependencies",
+			Type:        GoPackage,
+			Outputs:     []string{"**/*.go"},
+			Expectation: []string{"/main.go"},
+		},
+		{
+			Name:        "generic dependencies",
+			Type:        GenericPackage,
+			Outputs:     []string{"**/*.go"},
+			Expectation: []string{"/_deps/lib/lib.go", "/main.go"},
+		},
+		{
+			Name:    "no match",
+			Outputs: []string{"app", "dist"},
+			Error:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, fn := range files {
+				fn = filepath.Join(dir, fn)
+				err := os.MkdirAll(filepath.Dir(fn), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(fn, []byte(fn), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pkg := &Package{PackageInternal: PackageInternal{Type: test.Type, Outputs: test.Outputs}}
+			res, err := pkg.resolveOutputs(dir)
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected error, got %v", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			act := make([]string, 0, len(res))
+			for fn := range res {
+				act = append(act, fn)
+			}
+			sort.Strings(act)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("resolveOutputs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBuildGoPlatforms(t *testing.T) {
+	t.Setenv(EnvvarGoCacheDir, t.TempDir())
+
+	wd := t.TempDir()
+	files := []string{"go.mod", "main.go", "linux_amd64/app", "darwin_arm64/app"}
+	for _, fn := range files {
+		fn = filepath.Join(wd, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(fn, []byte(fn), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkg := &Package{
+		C: &Component{
+			W:      &Workspace{Origin: t.TempDir()},
+			Origin: wd,
+			Name:   "comp",
+		},
+		PackageInternal: PackageInternal{Name: "app", Type: GoPackage},
+		Config: GoPkgConfig{
+			Packaging:      GoApp,
+			Platforms:      []string{"linux/amd64", "darwin/arm64"},
+			BuildFlags:     []string{"-trimpath"},
+			DontTest:       true,
+			DontLint:       true,
+			DontCheckGoFmt: true,
+		},
+		dependencies: []*Package{},
+	}
+	bld, err := pkg.buildGo(&buildContext{}, wd, "result.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCommands := [][]string{
+		{"env", "GOOS=linux", "GOARCH=amd64", "go", "build", "-o", "linux_amd64/", "-trimpath", "."},
+		{"env", "GOOS=darwin", "GOARCH=arm64", "go", "build", "-o", "darwin_arm64/", "-trimpath", "."},
+	}
+	if diff := cmp.Diff(expectedCommands, bld.Commands[PackageBuildPhaseBuild]); diff != "" {
+		t.Errorf("build commands mismatch (-want +got):\n%s", diff)
+	}
+
+	if bld.PostBuild == nil {
+		t.Fatal("expected PostBuild for a package with platforms")
+	}
+	subjects, _, err := bld.PostBuild(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	act := make([]string, 0, len(subjects))
+	for _, s := range subjects {
+		act = append(act, s.Name)
+	}
+	sort.Strings(act)
+	if diff := cmp.Diff([]string{"/darwin_arm64/app", "/linux_amd64/app"}, act); diff != "" {
+		t.Errorf("subjects mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGoEnvironment(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Config      GoPkgConfig
+		GoMod       string
+		Expectation []string
+	}{
+		{
+			Name:        "goVersion",
+			Config:      GoPkgConfig{Packaging: GoApp, GoVersion: "1.22.5"},
+			GoMod:       "module foo\n\ngo 1.22\n\ntoolchain go1.23.1\n",
+			Expectation: []string{"GOTOOLCHAIN=go1.22.5"},
+		},
+		{
+			Name:        "toolchain directive",
+			Config:      GoPkgConfig{Packaging: GoApp},
+			GoMod:       "module foo\n\ngo 1.22\n\ntoolchain go1.23.1\n",
+			Expectation: []string{"GOTOOLCHAIN=go1.23.1"},
+		},
+		{
+			Name:   "not pinned",
+			Config: GoPkgConfig{Packaging: GoApp},
+			GoMod:  "module foo\n\ngo 1.22\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			t.Setenv(EnvvarGoCacheDir, "/gocache")
+			t.Setenv(EnvvarGoToolchainCache, "")
+
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(test.GoMod), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkg := &Package{
+				C:               &Component{W: &Workspace{Origin: dir}, Origin: dir},
+				PackageInternal: PackageInternal{Type: GoPackage},
+				Config:          test.Config,
+				dependencies:    []*Package{},
+			}
+
+			expectation := append([]string{"GOCACHE=/gocache/build", "GOMODCACHE=/gocache/mod"}, test.Expectation...)
+			if diff := cmp.Diff(expectation, pkg.goEnvironment("/build")); diff != "" {
+				t.Errorf("goEnvironment() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGoEnvironmentGoFlags(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Hermetic    WorkspaceHermetic
+		Expectation string
+	}{
+		{Name: "host flags", Expectation: "GOFLAGS=-tags=foo -trimpath -mod=mod"},
+		{Name: "passed flags", Hermetic: WorkspaceHermetic{Enabled: true, PassEnv: []string{"GOFLAGS"}}, Expectation: "GOFLAGS=-tags=foo -trimpath -mod=mod"},
+		{Name: "filtered flags", Hermetic: WorkspaceHermetic{Enabled: true}, Expectation: "GOFLAGS=-mod=mod"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			t.Setenv("GOFLAGS", "-tags=foo -mod=vendor -trimpath")
+
+			ws := &Workspace{Origin: t.TempDir(), Hermetic: test.Hermetic}
+			modcache := &Package{
+				C:               &Component{W: ws, Origin: ws.Origin, Name: "comp"},
+				PackageInternal: PackageInternal{Name: "modcache", Type: GoPackage},
+				Config:          GoPkgConfig{Packaging: GoModCache},
+				dependencies:    []*Package{},
+			}
+			pkg := &Package{
+				C:               modcache.C,
+				PackageInternal: PackageInternal{Name: "app", Type: GoPackage},
+				Config:          GoPkgConfig{Packaging: GoApp},
+				dependencies:    []*Package{modcache},
+			}
+
+			var act []string
+			for _, e := range pkg.goEnvironment("/build") {
+				if strings.HasPrefix(e, "GOFLAGS=") {
+					act = append(act, e)
+				}
+			}
+			if diff := cmp.Diff([]string{test.Expectation}, act); diff != "" {
+				t.Errorf("goEnvironment() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"_deps/comp--lib", "with space", "it's", "$HOME;*", ""} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != s {
+			t.Errorf("shellQuote(%q) = %s, which the shell turns into %q", s, shellQuote(s), out)
+		}
+	}
+}
+
+func TestNetworkIsolationError(t *testing.T) {
+	cause := errors.New("exit status 1")
+	pkg := &Package{PackageInternal: PackageInternal{Network: NetworkPullOnly}}
+
+	err := networkIsolationError(pkg, PackageBuildPhaseTest, cause)
+	if exp := "test phase failed without network access (package sets network: pull-only): exit status 1"; err.Error() != exp {
+		t.Errorf("unexpected error message: %q, expected %q", err.Error(), exp)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("error does not wrap the failure of the phase")
+	}
+}
@@ -19,7 +19,7 @@ func checkForCpCompatibility() error {
 	return nil
 }
 
-func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string, commands [][]string) error {
+func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string, commands [][]string, isolation sandboxIsolation, cg *packageCgroup) error {
 	tmpdir, err := os.MkdirTemp("", "turbocache-*")
 	if err != nil {
 		return err
@@ -53,6 +53,10 @@ func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string
 
 	spec := specconv.Example()
 	specconv.ToRootless(spec)
+	if isolation.Network {
+		// ToRootless removes the network namespace which would give the build access to the host network
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.NetworkNamespace})
+	}
 
 	// we assemble the root filesystem from the outside world
 	for _, d := range []string{"home", "bin", "dev", "etc", "lib", "lib64", "opt", "sbin", "sys", "usr", "var"} {
@@ -86,6 +90,12 @@ func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string
 	}
 	spec.Mounts = append(spec.Mounts, specs.Mount{Destination: "/turbocache", Source: self, Type: "bind", Options: []string{"bind", "private"}})
 
+	if p.Type == GoPackage {
+		caches := p.C.W.GoCaches()
+		for _, dir := range []string{caches.Build, caches.Module} {
+			spec.Mounts = append(spec.Mounts, specs.Mount{Destination: dir, Source: dir, Type: "bind", Options: []string{"bind", "private"}})
+		}
+	}
 	if p := os.Getenv("GOPATH"); p != "" {
 		spec.Mounts = append(spec.Mounts, specs.Mount{Destination: p, Source: p, Type: "bind", Options: []string{"bind", "private"}})
 	}
@@ -108,6 +118,9 @@ func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string
 		}
 		env = append(env, fmt.Sprintf("%s=%s", e, val))
 	}
+	if p.Type == GoPackage {
+		env = append(env, p.goEnvironment("/build")...)
+	}
 
 	spec.Hostname = name
 	spec.Process.Terminal = false
@@ -144,5 +157,6 @@ func executeCommandsForPackageSafe(buildctx *buildContext, p *Package, wd string
 	cmd.Dir = tmpdir
 	cmd.Stdout = &reporterStream{R: buildctx.Reporter, P: p, IsErr: false}
 	cmd.Stderr = &reporterStream{R: buildctx.Reporter, P: p, IsErr: true}
+	cg.Apply(cmd)
 	return cmd.Run()
 }
@@ -12,6 +12,7 @@ import (
 
 const dummyDocker = `#!/bin/bash
 
+ALL_ARGS="$*"
 POSITIONAL_ARGS=()
 
 while [[ $# -gt 0 ]]; do
@@ -21,6 +22,16 @@ while [[ $# -gt 0 ]]; do
       shift # past argument
       shift # past value
       ;;
+    --output)
+      BUILDX_OUTPUT="$2"
+      shift # past argument
+      shift # past value
+      ;;
+    --metadata-file)
+      METADATA="$2"
+      shift # past argument
+      shift # past value
+      ;;
     *)
       POSITIONAL_ARGS+=("$1") # save positional arg
       shift # past argument
@@ -30,8 +41,24 @@ done
 
 set -- "${POSITIONAL_ARGS[@]}" # restore positional parameters
 
+if [ "${POSITIONAL_ARGS}" == "inspect" ]; then
+	echo "foobar@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+fi
+
 if [ "${POSITIONAL_ARGS}" == "save" ]; then
-	tar cvvfz "${OUTPUT}" -T /dev/null
+	tar cvvf "${OUTPUT}" -T /dev/null
+fi
+
+if [ "${POSITIONAL_ARGS}" == "buildx" ]; then
+	echo "docker ${ALL_ARGS}"
+	case "${BUILDX_OUTPUT}" in
+	  type=oci,dest=*)
+	    tar cvvf "${BUILDX_OUTPUT#type=oci,dest=}" -T /dev/null
+	    ;;
+	esac
+	if [ -n "${METADATA}" ]; then
+		echo '{"containerimage.digest": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}' > "${METADATA}"
+	fi
 fi
 `
 
@@ -57,7 +84,7 @@ func TestBuildDockerDeps(t *testing.T) {
 			Name:        "docker dependency",
 			T:           t,
 			Args:        []string{"build", "-v", "-c", "none", "comp:pkg1"},
-			StderrSub:   "DEP_COMP__PKG0=foobar:1234",
+			StderrSub:   "DEP_COMP__PKG0=foobar@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 			NoStdoutSub: "already built",
 			ExitCode:    0,
 			Fixture: &testutil.Setup{
@@ -94,6 +121,131 @@ func TestBuildDockerDeps(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:        "exported docker dependency",
+			T:           t,
+			Args:        []string{"build", "-v", "-c", "none", "comp:pkg1"},
+			StderrSub:   "DEP_COMP__PKG0=turbocache/comp--pkg0:",
+			NoStdoutSub: "already built",
+			ExitCode:    0,
+			Fixture: &testutil.Setup{
+				Components: []testutil.Component{
+					{
+						Location: "comp",
+						Files: map[string]string{
+							"pkg0.Dockerfile": "FROM alpine:latest",
+							"pkg1.Dockerfile": "FROM ${DEP_COMP__PKG0}",
+						},
+						Packages: []turbocache.Package{
+							{
+								PackageInternal: turbocache.PackageInternal{
+									Name: "pkg0",
+									Type: turbocache.DockerPackage,
+								},
+								Config: turbocache.DockerPkgConfig{
+									Dockerfile: "pkg0.Dockerfile",
+								},
+							},
+							{
+								PackageInternal: turbocache.PackageInternal{
+									Name:         "pkg1",
+									Type:         turbocache.DockerPackage,
+									Dependencies: []string{":pkg0"},
+								},
+								Config: turbocache.DockerPkgConfig{
+									Dockerfile: "pkg1.Dockerfile",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test.Run()
+	}
+}
+
+func TestBuildDockerBuildx(t *testing.T) {
+	if *testutil.Dut {
+		pth, err := os.MkdirTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(pth, "docker"), []byte(dummyDocker), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(pth) })
+
+		os.Setenv("PATH", pth+":"+os.Getenv("PATH"))
+		log.WithField("path", os.Getenv("PATH")).Debug("modified path to use dummy docker")
+	}
+	testutil.RunDUT()
+
+	tests := []*testutil.CommandFixtureTest{
+		{
+			Name:        "buildx push",
+			T:           t,
+			Args:        []string{"build", "-v", "-c", "none", "comp:pkg"},
+			StdoutSubs:  []string{`docker buildx build --pull --cache-from`, `--output type=image,"name=foobar:1234,foobar:latest",push=true --metadata-file buildx-metadata.json`},
+			NoStdoutSub: " -t ",
+			ExitCode:    0,
+			Fixture: &testutil.Setup{
+				Components: []testutil.Component{
+					{
+						Location: "comp",
+						Files: map[string]string{
+							"Dockerfile": "FROM alpine:latest",
+						},
+						Packages: []turbocache.Package{
+							{
+								PackageInternal: turbocache.PackageInternal{
+									Name: "pkg",
+									Type: turbocache.DockerPackage,
+								},
+								Config: turbocache.DockerPkgConfig{
+									Dockerfile: "Dockerfile",
+									Backend:    turbocache.DockerBackendBuildx,
+									Image:      []string{"foobar:1234", "foobar:latest"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:       "buildx export",
+			T:          t,
+			Args:       []string{"build", "-v", "-c", "none", "comp:pkg"},
+			StdoutSubs: []string{"docker buildx build --pull -t ", "--output type=oci,dest="},
+			ExitCode:   0,
+			Fixture: &testutil.Setup{
+				Components: []testutil.Component{
+					{
+						Location: "comp",
+						Files: map[string]string{
+							"Dockerfile": "FROM alpine:latest",
+						},
+						Packages: []turbocache.Package{
+							{
+								PackageInternal: turbocache.PackageInternal{
+									Name: "pkg",
+									Type: turbocache.DockerPackage,
+								},
+								Config: turbocache.DockerPkgConfig{
+									Dockerfile: "Dockerfile",
+									Backend:    turbocache.DockerBackendBuildx,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
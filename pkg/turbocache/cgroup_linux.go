@@ -0,0 +1,227 @@
+package turbocache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// cgroupMountpoint is where we expect the cgroup v2 hierarchy to be mounted
+	cgroupMountpoint = "/sys/fs/cgroup"
+
+	// cgroupCPUPeriod is the CPU period in microseconds we set CPU limits for
+	cgroupCPUPeriod = 100000
+)
+
+// cgroupControllers are the cgroup v2 controllers we enable for package cgroups
+var cgroupControllers = []string{"cpu", "memory", "pids"}
+
+// cgroupManager creates the cgroups package builds run in. All package cgroups are direct children of the parent cgroup.
+type cgroupManager struct {
+	parent string
+}
+
+// newCgroupManager prepares the parent cgroup so that package cgroups can be created within it.
+// If parent is empty we use the cgroup turbocache runs in.
+func newCgroupManager(parent string) (*cgroupManager, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMountpoint, "cgroup.controllers")); err != nil {
+		return nil, xerrors.Errorf("resource limits require a cgroup v2 hierarchy mounted at %s", cgroupMountpoint)
+	}
+
+	var own bool
+	if parent == "" {
+		fc, err := os.ReadFile("/proc/self/cgroup")
+		if err != nil {
+			return nil, err
+		}
+		parent, err = parseOwnCgroup(string(fc))
+		if err != nil {
+			return nil, err
+		}
+		own = true
+	}
+	if !filepath.IsAbs(parent) || !strings.HasPrefix(parent, cgroupMountpoint) {
+		parent = filepath.Join(cgroupMountpoint, parent)
+	}
+
+	err := enableCgroupControllers(parent)
+	if errors.Is(err, unix.EBUSY) && own {
+		// cgroup v2 does not allow processes in a cgroup which delegates controllers to its children.
+		// We move ourselves to a leaf cgroup to make room for the package cgroups.
+		leaf := filepath.Join(parent, fmt.Sprintf("turbocache-%d", os.Getpid()))
+		log.WithField("cgroup", leaf).Debug("moving turbocache into its own cgroup")
+		err = os.MkdirAll(leaf, 0755)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot create cgroup: %w", err)
+		}
+		err = os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot move turbocache to cgroup %s: %w", leaf, err)
+		}
+		err = enableCgroupControllers(parent)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("cannot enable cgroup controllers in %s (use --cgroup-parent to point turbocache to a delegated cgroup): %w", parent, err)
+	}
+
+	return &cgroupManager{parent: parent}, nil
+}
+
+// parseOwnCgroup finds the cgroup v2 path in the content of /proc/self/cgroup
+func parseOwnCgroup(content string) (string, error) {
+	for _, l := range strings.Split(content, "\n") {
+		if strings.HasPrefix(l, "0::") {
+			return strings.TrimPrefix(l, "0::"), nil
+		}
+	}
+	return "", xerrors.Errorf("not running in a cgroup v2 hierarchy")
+}
+
+// enableCgroupControllers makes the cgroup controllers we need available to the children of the cgroup
+func enableCgroupControllers(cgroup string) error {
+	fc, err := os.ReadFile(filepath.Join(cgroup, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	available := strings.Fields(string(fc))
+
+	var ctrls []string
+	for _, c := range cgroupControllers {
+		for _, a := range available {
+			if a == c {
+				ctrls = append(ctrls, "+"+c)
+				break
+			}
+		}
+	}
+	if len(ctrls) == 0 {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(cgroup, "cgroup.subtree_control"), []byte(strings.Join(ctrls, " ")), 0644)
+}
+
+// packageCgroup is the cgroup the build commands of a single package run in
+type packageCgroup struct {
+	path string
+	fd   int
+}
+
+// NewPackageCgroup creates a cgroup for a package build and applies the package's resource limits to it
+func (m *cgroupManager) NewPackageCgroup(p *Package, buildID string) (*packageCgroup, error) {
+	path := filepath.Join(m.parent, fmt.Sprintf("turbocache-%s-%s", buildID, p.FilesystemSafeName()))
+	err := os.Mkdir(path, 0755)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot create cgroup for %s: %w", p.FullName(), err)
+	}
+
+	for fn, val := range cgroupLimits(p.Resources) {
+		err = os.WriteFile(filepath.Join(path, fn), []byte(val), 0644)
+		if err != nil {
+			_ = os.Remove(path)
+			return nil, xerrors.Errorf("cannot set %s of %s: %w", fn, p.FullName(), err)
+		}
+	}
+
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, xerrors.Errorf("cannot open cgroup of %s: %w", p.FullName(), err)
+	}
+
+	log.WithField("package", p.FullName()).WithField("cgroup", path).Debug("created package cgroup")
+	return &packageCgroup{path: path, fd: fd}, nil
+}
+
+// cgroupLimits translates the resource limits into cgroup v2 interface files and their content
+func cgroupLimits(r PackageResources) map[string]string {
+	res := make(map[string]string)
+	if r.Memory > 0 {
+		res["memory.max"] = strconv.FormatUint(uint64(r.Memory), 10)
+	}
+	if r.CPU > 0 {
+		quota := int64(r.CPU * cgroupCPUPeriod)
+		if quota < 1000 {
+			// the kernel does not accept quotas below 1ms
+			quota = 1000
+		}
+		res["cpu.max"] = fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)
+	}
+	if r.PIDs > 0 {
+		res["pids.max"] = strconv.FormatInt(r.PIDs, 10)
+	}
+	return res
+}
+
+// Apply makes the command start in the package cgroup
+func (cg *packageCgroup) Apply(cmd *exec.Cmd) {
+	if cg == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = cg.fd
+}
+
+// Close kills all processes left in the package cgroup, removes it and returns the resources the package build used
+func (cg *packageCgroup) Close() (usage packageResourceUsage, err error) {
+	defer unix.Close(cg.fd)
+
+	if fc, err := os.ReadFile(filepath.Join(cg.path, "memory.peak")); err == nil {
+		usage.PeakMemoryBytes, _ = strconv.ParseUint(strings.TrimSpace(string(fc)), 10, 64)
+	}
+	fc, statErr := os.ReadFile(filepath.Join(cg.path, "cpu.stat"))
+
+	// Build commands may have left processes behind which keep the cgroup busy.
+	// We remove the cgroup even if we cannot tell the resource usage, so that neither the cgroup nor those processes leak.
+	_ = os.WriteFile(filepath.Join(cg.path, "cgroup.kill"), []byte("1"), 0644)
+	for i := 0; ; i++ {
+		err = os.Remove(cg.path)
+		if err == nil || i >= 50 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		log.WithError(err).WithField("cgroup", cg.path).Warn("cannot remove package cgroup")
+	}
+
+	if statErr != nil {
+		return usage, xerrors.Errorf("cannot read CPU usage: %w", statErr)
+	}
+	usage.CPUTime, err = parseCgroupCPUUsage(string(fc))
+	if err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// parseCgroupCPUUsage reads the total CPU time from the content of a cpu.stat file
+func parseCgroupCPUUsage(content string) (time.Duration, error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "usage_usec" {
+			continue
+		}
+		usec, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, xerrors.Errorf("cannot parse CPU usage: %w", err)
+		}
+		return time.Duration(usec) * time.Microsecond, nil
+	}
+	return 0, xerrors.Errorf("cpu.stat does not contain usage_usec")
+}
@@ -0,0 +1,71 @@
+package turbocache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Resources   PackageResources
+		Expectation map[string]string
+	}{
+		{Name: "no limits", Expectation: map[string]string{}},
+		{
+			Name:      "all limits",
+			Resources: PackageResources{Memory: 4 << 30, CPU: 1.5, PIDs: 512},
+			Expectation: map[string]string{
+				"memory.max": "4294967296",
+				"cpu.max":    "150000 100000",
+				"pids.max":   "512",
+			},
+		},
+		{
+			Name:        "tiny CPU share",
+			Resources:   PackageResources{CPU: 0.001},
+			Expectation: map[string]string{"cpu.max": "1000 100000"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := cgroupLimits(test.Resources)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("cgroupLimits() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCgroupCPUUsage(t *testing.T) {
+	act, err := parseCgroupCPUUsage("usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s, actual %s", act)
+	}
+
+	_, err = parseCgroupCPUUsage("user_usec 1000000\n")
+	if err == nil {
+		t.Errorf("expected error for missing usage_usec")
+	}
+}
+
+func TestParseOwnCgroup(t *testing.T) {
+	act, err := parseOwnCgroup("0::/user.slice/user-1000.slice/session-1.scope\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act != "/user.slice/user-1000.slice/session-1.scope" {
+		t.Errorf("unexpected cgroup: %s", act)
+	}
+
+	_, err = parseOwnCgroup("4:memory:/foo\n1:cpu:/\n")
+	if err == nil {
+		t.Errorf("expected error for cgroup v1 only hierarchy")
+	}
+}
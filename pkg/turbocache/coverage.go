@@ -0,0 +1,379 @@
+package turbocache
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// coverageLCOVReport is the name of the merged LCOV report written to the coverage output path
+	coverageLCOVReport = "lcov.info"
+
+	// coverageCoberturaReport is the name of the merged Cobertura report written to the coverage output path
+	coverageCoberturaReport = "cobertura.xml"
+)
+
+// lineCoverage maps source files, relative to the workspace root, to the number of times
+// each of their lines ran during the tests.
+type lineCoverage map[string]map[int]int
+
+// lineCoverageFunc produces the line coverage of a package build. It is called after the test phase has finished.
+type lineCoverageFunc func() (lineCoverage, error)
+
+// add records that a line ran hits times. Lines covered by several blocks or packages count as often as the most frequent of them.
+func (c lineCoverage) add(fn string, line, hits int) {
+	lines, ok := c[fn]
+	if !ok {
+		lines = make(map[int]int)
+		c[fn] = lines
+	}
+	if cur, ok := lines[line]; !ok || hits > cur {
+		lines[line] = hits
+	}
+}
+
+// merge adds all lines of other to this coverage
+func (c lineCoverage) merge(other lineCoverage) {
+	for fn, lines := range other {
+		for line, hits := range lines {
+			c.add(fn, line, hits)
+		}
+	}
+}
+
+// files returns the covered files in lexical order
+func (c lineCoverage) files() []string {
+	res := make([]string, 0, len(c))
+	for fn := range c {
+		res = append(res, fn)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// lines returns the lines of a file in ascending order, as well as how many of them are covered
+func (c lineCoverage) lines(fn string) (lines []int, covered int) {
+	for line, hits := range c[fn] {
+		lines = append(lines, line)
+		if hits > 0 {
+			covered++
+		}
+	}
+	sort.Ints(lines)
+	return
+}
+
+// WriteLCOV writes the coverage in the LCOV tracefile format
+func (c lineCoverage) WriteLCOV(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "TN:")
+	for _, fn := range c.files() {
+		lines, covered := c.lines(fn)
+		fmt.Fprintf(w, "SF:%s\n", fn)
+		for _, line := range lines {
+			fmt.Fprintf(w, "DA:%d,%d\n", line, c[fn][line])
+		}
+		fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), covered)
+	}
+	return w.Flush()
+}
+
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        float64            `xml:"line-rate,attr"`
+	BranchRate      float64            `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      float64            `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Complexity float64          `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Complexity float64         `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// WriteCobertura writes the coverage as Cobertura XML report. Each directory becomes a package and each file a class.
+// source is the directory the file names are relative to.
+func (c lineCoverage) WriteCobertura(out io.Writer, source string, timestamp time.Time) error {
+	var (
+		report = coberturaCoverage{
+			Version:   "turbocache",
+			Timestamp: timestamp.Unix(),
+			Sources:   []string{source},
+		}
+		pkgs     = make(map[string]*coberturaPackage)
+		pkgNames []string
+		pkgLines = make(map[string][2]int)
+		rate     = func(covered, valid int) float64 {
+			if valid == 0 {
+				return 0
+			}
+			return float64(covered) / float64(valid)
+		}
+	)
+	for _, fn := range c.files() {
+		lines, covered := c.lines(fn)
+
+		name := path.Dir(filepath.ToSlash(fn))
+		pkg, ok := pkgs[name]
+		if !ok {
+			pkg = &coberturaPackage{Name: name}
+			pkgs[name] = pkg
+			pkgNames = append(pkgNames, name)
+		}
+		cls := coberturaClass{
+			Name:     strings.TrimSuffix(path.Base(filepath.ToSlash(fn)), path.Ext(fn)),
+			Filename: fn,
+			LineRate: rate(covered, len(lines)),
+		}
+		for _, line := range lines {
+			cls.Lines = append(cls.Lines, coberturaLine{Number: line, Hits: c[fn][line]})
+		}
+		pkg.Classes = append(pkg.Classes, cls)
+
+		pl := pkgLines[name]
+		pkgLines[name] = [2]int{pl[0] + covered, pl[1] + len(lines)}
+		report.LinesCovered += covered
+		report.LinesValid += len(lines)
+	}
+	sort.Strings(pkgNames)
+	for _, name := range pkgNames {
+		pkg := pkgs[name]
+		pkg.LineRate = rate(pkgLines[name][0], pkgLines[name][1])
+		report.Packages = append(report.Packages, *pkg)
+	}
+	report.LineRate = rate(report.LinesCovered, report.LinesValid)
+
+	_, err := io.WriteString(out, xml.Header+`<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">`+"\n")
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	err = enc.Encode(report)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n")
+	return err
+}
+
+// writeCoverageReports writes the merged LCOV and Cobertura reports to dir
+func writeCoverageReports(dir, source string, cov lineCoverage) error {
+	for fn, write := range map[string]func(io.Writer) error{
+		coverageLCOVReport: cov.WriteLCOV,
+		coverageCoberturaReport: func(out io.Writer) error {
+			return cov.WriteCobertura(out, source, time.Now())
+		},
+	} {
+		f, err := os.Create(filepath.Join(dir, fn))
+		if err != nil {
+			return xerrors.Errorf("cannot write coverage report: %w", err)
+		}
+		err = write(f)
+		f.Close()
+		if err != nil {
+			return xerrors.Errorf("cannot write coverage report %s: %w", fn, err)
+		}
+	}
+	return nil
+}
+
+// parseGoCoverProfile reads a Go cover profile. File names in the profile are import paths.
+// Those within the module modulePath are made relative to the workspace by replacing the module path with dir.
+func parseGoCoverProfile(in io.Reader, modulePath, dir string) (lineCoverage, error) {
+	// The profile looks like this:
+	//   mode: set
+	//   github.com/khulnasoft/turbocache/pkg/foo/foo.go:10.40,12.16 2 1
+	res := make(lineCoverage)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		segs := strings.Fields(line)
+		if len(segs) != 3 {
+			return nil, xerrors.Errorf("invalid cover profile line: %s", line)
+		}
+		fn, block, ok := strings.Cut(segs[0], ":")
+		if !ok {
+			return nil, xerrors.Errorf("invalid cover profile line: %s", line)
+		}
+		start, end, ok := strings.Cut(block, ",")
+		if !ok {
+			return nil, xerrors.Errorf("invalid cover profile line: %s", line)
+		}
+		startLine, err := strconv.Atoi(strings.Split(start, ".")[0])
+		if err != nil {
+			return nil, xerrors.Errorf("invalid cover profile line: %s", line)
+		}
+		endLine, err := strconv.Atoi(strings.Split(end, ".")[0])
+		if err != nil {
+			return nil, xerrors.Errorf("invalid cover profile line: %s", line)
+		}
+		hits, err := strconv.Atoi(segs[2])
+		if err != nil {
+			return nil, xerrors.Errorf("invalid cover profile line: %s", line)
+		}
+
+		if rel, ok := strings.CutPrefix(fn, modulePath+"/"); ok {
+			fn = path.Join(filepath.ToSlash(dir), rel)
+		}
+		for l := startLine; l <= endLine; l++ {
+			res.add(fn, l, hits)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// errNoTestCoverage is returned by testCoverageFuncs if the tests did not produce a coverage report
+var errNoTestCoverage = xerrors.New("tests did not produce a coverage report")
+
+// istanbulSummary is the coverage-summary.json written by the json-summary reporter of istanbul, e.g. when running Jest
+type istanbulSummary struct {
+	Total struct {
+		Statements istanbulTotals `json:"statements"`
+		Functions  istanbulTotals `json:"functions"`
+	} `json:"total"`
+}
+
+type istanbulTotals struct {
+	Total   int     `json:"total"`
+	Covered int     `json:"covered"`
+	Pct     float64 `json:"pct"`
+}
+
+// parseIstanbulSummary reads the statement coverage and function counts from an istanbul coverage-summary.json
+func parseIstanbulSummary(in io.Reader) (coverage, funcsWithoutTest, funcsWithTest int, err error) {
+	var summary istanbulSummary
+	err = json.NewDecoder(in).Decode(&summary)
+	if err != nil {
+		return 0, 0, 0, xerrors.Errorf("cannot parse coverage summary: %w", err)
+	}
+
+	fns := summary.Total.Functions
+	return int(summary.Total.Statements.Pct), fns.Total - fns.Covered, fns.Covered, nil
+}
+
+// lcovTotals are the line and function counts of an LCOV report
+type lcovTotals struct {
+	LinesFound     int
+	LinesHit       int
+	FunctionsFound int
+	FunctionsHit   int
+}
+
+// Coverage returns the line coverage in percent
+func (t lcovTotals) Coverage() int {
+	if t.LinesFound == 0 {
+		return 0
+	}
+	return t.LinesHit * 100 / t.LinesFound
+}
+
+// parseLCOV reads an LCOV tracefile. Source files within wd are made relative to the workspace by replacing wd with dir.
+// Relative source files are expected to be relative to wd.
+func parseLCOV(in io.Reader, wd, dir string) (cov lineCoverage, totals lcovTotals, err error) {
+	// The tracefile looks like this:
+	//   SF:/build/src/index.js
+	//   FNF:2
+	//   FNH:1
+	//   DA:1,3
+	//   LF:1
+	//   LH:1
+	//   end_of_record
+	cov = make(lineCoverage)
+	var (
+		scanner = bufio.NewScanner(in)
+		fn      string
+	)
+	for scanner.Scan() {
+		key, val, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		switch key {
+		case "SF":
+			fn = val
+			if rel, err := filepath.Rel(wd, fn); err == nil && !strings.HasPrefix(rel, "..") {
+				fn = rel
+			}
+			if !filepath.IsAbs(fn) {
+				fn = path.Join(filepath.ToSlash(dir), filepath.ToSlash(fn))
+			}
+		case "DA":
+			segs := strings.Split(val, ",")
+			if len(segs) < 2 || fn == "" {
+				return nil, lcovTotals{}, xerrors.Errorf("invalid LCOV line: DA:%s", val)
+			}
+			line, err := strconv.Atoi(segs[0])
+			if err != nil {
+				return nil, lcovTotals{}, xerrors.Errorf("invalid LCOV line: DA:%s", val)
+			}
+			hits, err := strconv.Atoi(segs[1])
+			if err != nil {
+				return nil, lcovTotals{}, xerrors.Errorf("invalid LCOV line: DA:%s", val)
+			}
+			cov.add(fn, line, hits)
+		case "LF", "LH", "FNF", "FNH":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, lcovTotals{}, xerrors.Errorf("invalid LCOV line: %s:%s", key, val)
+			}
+			switch key {
+			case "LF":
+				totals.LinesFound += n
+			case "LH":
+				totals.LinesHit += n
+			case "FNF":
+				totals.FunctionsFound += n
+			case "FNH":
+				totals.FunctionsHit += n
+			}
+		case "end_of_record":
+			fn = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, lcovTotals{}, err
+	}
+	return cov, totals, nil
+}
@@ -0,0 +1,269 @@
+package turbocache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseGoCoverProfile(t *testing.T) {
+	type Expectation struct {
+		Error    string
+		Coverage lineCoverage
+	}
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation Expectation
+	}{
+		{
+			Name:        "empty",
+			Input:       "mode: set\n",
+			Expectation: Expectation{Coverage: lineCoverage{}},
+		},
+		{
+			Name: "valid",
+			Input: `mode: count
+example.com/foo/pkg/bar.go:3.20,5.2 2 4
+example.com/foo/pkg/bar.go:5.2,6.10 1 0
+example.com/foo/main.go:8.13,9.2 1 0
+example.com/other/other.go:1.1,1.10 1 1
+`,
+			Expectation: Expectation{Coverage: lineCoverage{
+				"components/foo/pkg/bar.go":  {3: 4, 4: 4, 5: 4, 6: 0},
+				"components/foo/main.go":     {8: 0, 9: 0},
+				"example.com/other/other.go": {1: 1},
+			}},
+		},
+		{
+			Name:        "invalid",
+			Input:       "mode: set\nexample.com/foo/main.go:8.13 1 0\n",
+			Expectation: Expectation{Error: "invalid cover profile line: example.com/foo/main.go:8.13 1 0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var (
+				act Expectation
+				err error
+			)
+			act.Coverage, err = parseGoCoverProfile(strings.NewReader(test.Input), "example.com/foo", "components/foo")
+			if err != nil {
+				act.Error = err.Error()
+			}
+
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("parseGoCoverProfile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLineCoverageMerge(t *testing.T) {
+	cov := lineCoverage{"a.go": {1: 1, 2: 0}}
+	cov.merge(lineCoverage{"a.go": {2: 3, 1: 0}, "b.go": {1: 0}})
+
+	expectation := lineCoverage{"a.go": {1: 1, 2: 3}, "b.go": {1: 0}}
+	if diff := cmp.Diff(expectation, cov); diff != "" {
+		t.Errorf("merge() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLineCoverageReports(t *testing.T) {
+	cov := lineCoverage{
+		"components/foo/main.go":    {8: 0, 9: 2},
+		"components/foo/pkg/bar.go": {3: 1},
+	}
+
+	var lcov bytes.Buffer
+	err := cov.WriteLCOV(&lcov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedLCOV := `TN:
+SF:components/foo/main.go
+DA:8,0
+DA:9,2
+LF:2
+LH:1
+end_of_record
+SF:components/foo/pkg/bar.go
+DA:3,1
+LF:1
+LH:1
+end_of_record
+`
+	if diff := cmp.Diff(expectedLCOV, lcov.String()); diff != "" {
+		t.Errorf("WriteLCOV() mismatch (-want +got):\n%s", diff)
+	}
+
+	var cobertura bytes.Buffer
+	err = cov.WriteCobertura(&cobertura, "/workspace", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCobertura := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">
+<coverage line-rate="0.6666666666666666" branch-rate="0" lines-covered="2" lines-valid="3" branches-covered="0" branches-valid="0" complexity="0" version="turbocache" timestamp="1700000000">
+  <sources>
+    <source>/workspace</source>
+  </sources>
+  <packages>
+    <package name="components/foo" line-rate="0.5" branch-rate="0" complexity="0">
+      <classes>
+        <class name="main" filename="components/foo/main.go" line-rate="0.5" branch-rate="0" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="8" hits="0"></line>
+            <line number="9" hits="2"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+    <package name="components/foo/pkg" line-rate="1" branch-rate="0" complexity="0">
+      <classes>
+        <class name="bar" filename="components/foo/pkg/bar.go" line-rate="1" branch-rate="0" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="3" hits="1"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>
+`
+	if diff := cmp.Diff(expectedCobertura, cobertura.String()); diff != "" {
+		t.Errorf("WriteCobertura() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseIstanbulSummary(t *testing.T) {
+	type Expectation struct {
+		Error            string
+		Coverage         int
+		FuncsWithoutTest int
+		FuncsWithTest    int
+	}
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation Expectation
+	}{
+		{
+			Name: "valid",
+			Input: `{
+				"total": {
+					"lines": {"total": 40, "covered": 30, "skipped": 0, "pct": 75},
+					"statements": {"total": 48, "covered": 33, "skipped": 0, "pct": 68.75},
+					"functions": {"total": 10, "covered": 7, "skipped": 0, "pct": 70},
+					"branches": {"total": 8, "covered": 4, "skipped": 0, "pct": 50}
+				},
+				"/build/src/index.js": {
+					"lines": {"total": 40, "covered": 30, "skipped": 0, "pct": 75}
+				}
+			}`,
+			Expectation: Expectation{
+				Coverage:         68,
+				FuncsWithoutTest: 3,
+				FuncsWithTest:    7,
+			},
+		},
+		{
+			Name:        "invalid",
+			Input:       "not json",
+			Expectation: Expectation{Error: "cannot parse coverage summary: invalid character 'o' in literal null (expecting 'u')"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var (
+				act Expectation
+				err error
+			)
+			act.Coverage, act.FuncsWithoutTest, act.FuncsWithTest, err = parseIstanbulSummary(strings.NewReader(test.Input))
+			if err != nil {
+				act.Error = err.Error()
+			}
+
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("parseIstanbulSummary() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseLCOV(t *testing.T) {
+	type Expectation struct {
+		Error    string
+		Coverage lineCoverage
+		Totals   lcovTotals
+	}
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation Expectation
+	}{
+		{
+			Name: "valid",
+			Input: `TN:
+SF:/build/src/index.js
+FN:1,main
+FNF:2
+FNH:1
+FNDA:3,main
+DA:1,3
+DA:2,0
+LF:2
+LH:1
+end_of_record
+SF:src/util.js
+FNF:1
+FNH:1
+DA:5,1
+LF:1
+LH:1
+end_of_record
+`,
+			Expectation: Expectation{
+				Coverage: lineCoverage{
+					"components/web/src/index.js": {1: 3, 2: 0},
+					"components/web/src/util.js":  {5: 1},
+				},
+				Totals: lcovTotals{LinesFound: 3, LinesHit: 2, FunctionsFound: 3, FunctionsHit: 2},
+			},
+		},
+		{
+			Name:        "invalid",
+			Input:       "SF:/build/src/index.js\nDA:one,1\n",
+			Expectation: Expectation{Error: "invalid LCOV line: DA:one,1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var (
+				act Expectation
+				err error
+			)
+			act.Coverage, act.Totals, err = parseLCOV(strings.NewReader(test.Input), "/build", "components/web")
+			if err != nil {
+				act.Error = err.Error()
+			}
+
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("parseLCOV() mismatch (-want +got):\n%s", diff)
+			}
+			if test.Expectation.Error == "" {
+				if cov := act.Totals.Coverage(); cov != 66 {
+					t.Errorf("Coverage() = %d, expected 66", cov)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package turbocache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// LiveWorkspace keeps a loaded workspace in sync with the filesystem. Changes to source files invalidate the versions
+// of the affected packages and their dependants only, whereas changes to the structure of the workspace (e.g. BUILD files
+// or new source files) cause a reload on the next call to Get.
+type LiveWorkspace struct {
+	path          string
+	args          Arguments
+	variant       string
+	provenanceKey string
+
+	watcher *fsnotify.Watcher
+
+	mu       sync.Mutex
+	ws       Workspace
+	loaded   bool
+	reload   bool
+	changed  map[string]struct{}
+	sources  map[string][]*Package
+	matchers []*pathMatcher
+	watched  map[string]struct{}
+	envState string
+}
+
+// NewLiveWorkspace starts watching the workspace at path. The workspace is loaded on the first call to Get.
+func NewLiveWorkspace(path string, args Arguments, variant, provenanceKey string) (*LiveWorkspace, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	lw := &LiveWorkspace{
+		path:          path,
+		args:          args,
+		variant:       variant,
+		provenanceKey: provenanceKey,
+		watcher:       watcher,
+		changed:       make(map[string]struct{}),
+		watched:       make(map[string]struct{}),
+	}
+	go lw.watch()
+	return lw, nil
+}
+
+// Close stops watching the workspace
+func (lw *LiveWorkspace) Close() error {
+	return lw.watcher.Close()
+}
+
+// Get returns the workspace, reflecting all changes to the filesystem up until now
+func (lw *LiveWorkspace) Get() (Workspace, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if lw.loaded && !lw.reload && len(lw.changed) > 0 {
+		lw.invalidateChanged()
+	}
+	if lw.loaded && !lw.reload && lw.environmentState() != lw.envState {
+		// envdeps and the hermetic passEnv hash are part of the package versions
+		log.Debug("version relevant environment changed - reloading workspace")
+		lw.reload = true
+	}
+	if !lw.loaded || lw.reload {
+		err := lw.load()
+		if err != nil {
+			return Workspace{}, err
+		}
+	}
+
+	return lw.ws, nil
+}
+
+// load loads the workspace from scratch and watches all of its directories
+func (lw *LiveWorkspace) load() error {
+	// loadWorkspace adds the argument defaults to the args, which must not leak into the next load
+	args := make(Arguments, len(lw.args))
+	for k, v := range lw.args {
+		args[k] = v
+	}
+	ws, err := FindWorkspace(lw.path, args, lw.variant, lw.provenanceKey)
+	if err != nil {
+		return err
+	}
+
+	sources := make(map[string][]*Package)
+	matchers := make([]*pathMatcher, 0, len(ws.Packages))
+	dirs := map[string]struct{}{ws.Origin: {}}
+	for _, pkg := range ws.Packages {
+		for _, src := range pkg.Sources {
+			sources[src] = append(sources[src], pkg)
+			dirs[filepath.Dir(src)] = struct{}{}
+		}
+		matchers = append(matchers, &pathMatcher{Base: pkg.C.Origin, Patterns: pkg.originalSources})
+	}
+	for _, comp := range ws.Components {
+		dirs[comp.Origin] = struct{}{}
+	}
+	if _, err := os.Stat(filepath.Join(ws.Origin, ".git")); err == nil {
+		dirs[filepath.Join(ws.Origin, ".git")] = struct{}{}
+	}
+	for dir := range dirs {
+		// we watch all directories between the workspace root and the sources to learn about new components
+		for d := dir; strings.HasPrefix(d, ws.Origin); d = filepath.Dir(d) {
+			lw.addWatch(d)
+			if d == ws.Origin {
+				break
+			}
+		}
+	}
+
+	lw.ws = ws
+	lw.sources = sources
+	lw.matchers = matchers
+	lw.loaded = true
+	lw.reload = false
+	lw.changed = make(map[string]struct{})
+	lw.envState = lw.environmentState()
+	log.WithField("packages", len(ws.Packages)).WithField("watches", len(lw.watched)).Debug("loaded live workspace")
+	return nil
+}
+
+func (lw *LiveWorkspace) addWatch(dir string) {
+	if _, exists := lw.watched[dir]; exists {
+		return
+	}
+	err := lw.watcher.Add(dir)
+	if err != nil {
+		log.WithError(err).WithField("path", dir).Warn("cannot watch directory - changes to it will go unnoticed")
+		return
+	}
+	lw.watched[dir] = struct{}{}
+}
+
+// invalidateChanged resets the version of all packages whose sources changed, and the versions of their dependants
+func (lw *LiveWorkspace) invalidateChanged() {
+	affected := make(map[*Package]struct{})
+	for fn := range lw.changed {
+		for _, pkg := range lw.sources[fn] {
+			affected[pkg] = struct{}{}
+			for _, dep := range pkg.TransitiveDependants() {
+				affected[dep] = struct{}{}
+			}
+		}
+	}
+	lw.changed = make(map[string]struct{})
+
+	for pkg := range affected {
+		if strings.Contains(string(pkg.Definition), "${__") {
+			// builtin variables, e.g. the package version, are resolved into the package config on load
+			lw.reload = true
+			return
+		}
+	}
+	for pkg := range affected {
+		log.WithField("package", pkg.FullName()).Debug("sources changed - invalidating version")
+		pkg.versionCache = ""
+	}
+}
+
+// environmentState captures the version relevant environment variables
+func (lw *LiveWorkspace) environmentState() string {
+	var res []string
+	for _, pkg := range lw.ws.Packages {
+		res = append(res, pkg.EnvDependencyValues()...)
+	}
+	if hermetic := lw.ws.Hermetic; hermetic.Enabled && hermetic.HashPassEnv {
+		passEnv, err := passEnvManifest(hermetic.FilterEnvironment(os.Environ()))
+		if err != nil {
+			log.WithError(err).Warn("cannot hash passEnv environment")
+		}
+		res = append(res, passEnv...)
+	}
+	sort.Strings(res)
+	return strings.Join(res, "\n")
+}
+
+func (lw *LiveWorkspace) watch() {
+	for {
+		select {
+		case evt, ok := <-lw.watcher.Events:
+			if !ok {
+				return
+			}
+			lw.mu.Lock()
+			lw.handleEvent(evt)
+			lw.mu.Unlock()
+		case err, ok := <-lw.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.WithError(err).Warn("workspace watcher error - reloading workspace on next use")
+			lw.mu.Lock()
+			lw.reload = true
+			lw.mu.Unlock()
+		}
+	}
+}
+
+// handleEvent records a filesystem change. It must be called with lw.mu held.
+func (lw *LiveWorkspace) handleEvent(evt fsnotify.Event) {
+	if !lw.loaded || lw.reload {
+		return
+	}
+
+	var (
+		fn   = evt.Name
+		base = filepath.Base(fn)
+		dir  = filepath.Dir(fn)
+	)
+	if dir == filepath.Join(lw.ws.Origin, ".git") {
+		if base == "HEAD" || base == "index" {
+			log.WithField("path", fn).Debug("Git state changed")
+			lw.reload = true
+		}
+		return
+	}
+	if lw.ws.ShouldIgnoreSource(fn) {
+		return
+	}
+
+	switch {
+	case base == "BUILD.yaml" || base == "BUILD.js":
+		lw.reload = true
+	case dir == lw.ws.Origin && (base == "WORKSPACE.yaml" || base == "WORKSPACE.args.yaml" || base == ".turbocacheignore"):
+		lw.reload = true
+	case evt.Has(fsnotify.Create):
+		if stat, err := os.Stat(fn); err == nil && stat.IsDir() {
+			lw.addWatch(fn)
+			lw.reload = true
+		} else if lw.isSource(fn) || lw.matchesSources(fn) {
+			lw.reload = true
+		}
+	case evt.Has(fsnotify.Remove) || evt.Has(fsnotify.Rename):
+		if _, watched := lw.watched[fn]; watched || lw.isSource(fn) {
+			lw.reload = true
+		}
+	case evt.Has(fsnotify.Write):
+		if lw.isSource(fn) {
+			lw.changed[fn] = struct{}{}
+		}
+	}
+	if lw.reload {
+		log.WithField("path", fn).Debug("workspace structure changed - reloading on next use")
+	}
+}
+
+func (lw *LiveWorkspace) isSource(fn string) bool {
+	_, ok := lw.sources[fn]
+	return ok
+}
+
+func (lw *LiveWorkspace) matchesSources(fn string) bool {
+	for _, m := range lw.matchers {
+		if m.Matches(fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// LiveWorkspaces keeps a live workspace per set of build arguments and variant
+type LiveWorkspaces struct {
+	Path string
+
+	mu  sync.Mutex
+	wss map[string]*LiveWorkspace
+}
+
+// Get returns the workspace for the arguments and variant
+func (lws *LiveWorkspaces) Get(path string, args Arguments, variant, provenanceKey string) (Workspace, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Workspace{}, err
+	}
+	if path != lws.Path {
+		return Workspace{}, xerrors.Errorf("this daemon serves %s, not %s", lws.Path, path)
+	}
+
+	keys := make([]string, 0, len(args))
+	for k, v := range args {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+	key := strings.Join(append(keys, "variant="+variant, "provenanceKey="+provenanceKey), "\n")
+
+	lws.mu.Lock()
+	if lws.wss == nil {
+		lws.wss = make(map[string]*LiveWorkspace)
+	}
+	lw, ok := lws.wss[key]
+	if !ok {
+		lw, err = NewLiveWorkspace(path, args, variant, provenanceKey)
+		if err != nil {
+			lws.mu.Unlock()
+			return Workspace{}, err
+		}
+		lws.wss[key] = lw
+	}
+	lws.mu.Unlock()
+
+	return lw.Get()
+}
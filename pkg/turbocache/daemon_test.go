@@ -0,0 +1,86 @@
+package turbocache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/khulnasoft/turbocache/pkg/turbocache"
+)
+
+func TestLiveWorkspace(t *testing.T) {
+	loc := t.TempDir()
+	layout := map[string]string{
+		"WORKSPACE.yaml":     "",
+		"pkg1/BUILD.yaml":    "packages:\n- name: foo\n  type: generic\n  srcs:\n  - \"*.txt\"\n  config:\n    commands:\n    - [\"echo\"]",
+		"pkg1/a.txt":         "a",
+		"pkg2/BUILD.yaml":    "packages:\n- name: bar\n  type: generic\n  deps:\n  - pkg1:foo\n  config:\n    commands:\n    - [\"echo\"]",
+		"pkg3/BUILD.yaml":    "packages:\n- name: baz\n  type: generic\n  srcs:\n  - \"*.txt\"\n  config:\n    commands:\n    - [\"echo\"]",
+		"pkg3/unrelated.txt": "c",
+	}
+	for fn, content := range layout {
+		err := os.MkdirAll(filepath.Join(loc, filepath.Dir(fn)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(loc, fn), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lw, err := turbocache.NewLiveWorkspace(loc, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lw.Close()
+
+	versions := func() map[string]string {
+		ws, err := lw.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make(map[string]string)
+		for name, pkg := range ws.Packages {
+			res[name], err = pkg.Version()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	// waitForChange polls the workspace because filesystem events arrive asynchronously
+	waitForChange := func(before map[string]string, pkg string) map[string]string {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			after := versions()
+			if after[pkg] != before[pkg] {
+				return after
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("version of %s did not change", pkg)
+		return nil
+	}
+
+	v0 := versions()
+
+	err = os.WriteFile(filepath.Join(loc, "pkg1/a.txt"), []byte("changed"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := waitForChange(v0, "pkg1:foo")
+	if v1["pkg2:bar"] == v0["pkg2:bar"] {
+		t.Errorf("version of dependant pkg2:bar did not change")
+	}
+	if v1["pkg3:baz"] != v0["pkg3:baz"] {
+		t.Errorf("version of unrelated pkg3:baz changed")
+	}
+
+	err = os.WriteFile(filepath.Join(loc, "pkg1/b.txt"), []byte("new"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForChange(v1, "pkg1:foo")
+}
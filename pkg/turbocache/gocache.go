@@ -0,0 +1,115 @@
+package turbocache
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// EnvvarGoCacheDir names the environment variable which configures where turbocache keeps the Go build and module caches
+const EnvvarGoCacheDir = "TURBOCACHE_GO_CACHE_DIR"
+
+// GoCaches are the GOCACHE and GOMODCACHE all Go package builds of a workspace share
+type GoCaches struct {
+	Build  string
+	Module string
+}
+
+// GoCaches returns the Go caches of the workspace. Unless configured using TURBOCACHE_GO_CACHE_DIR,
+// they live in the user cache directory, in a folder derived from the workspace location.
+func (ws *Workspace) GoCaches() GoCaches {
+	root := os.Getenv(EnvvarGoCacheDir)
+	if root == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		hash := sha1.Sum([]byte(ws.Origin))
+		root = filepath.Join(base, "turbocache", fmt.Sprintf("go-%x", hash[:4]))
+	}
+	return GoCaches{
+		Build:  filepath.Join(root, "build"),
+		Module: filepath.Join(root, "mod"),
+	}
+}
+
+// Ensure creates the cache directories if they don't exist yet
+func (c GoCaches) Ensure() error {
+	for _, dir := range []string{c.Build, c.Module} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return xerrors.Errorf("cannot create Go cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// Env returns the environment variables which make the go command use the caches
+func (c GoCaches) Env() []string {
+	return []string{
+		"GOCACHE=" + c.Build,
+		"GOMODCACHE=" + c.Module,
+	}
+}
+
+// Trim removes all entries from the build cache which have not been used for maxAge.
+// Much like the go command itself, we rely on the go command updating the modification time of the entries it uses.
+func (c GoCaches) Trim(maxAge time.Duration) (removedFiles int, removedBytes int64, err error) {
+	cutoff := time.Now().Add(-maxAge)
+	err = filepath.WalkDir(c.Build, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch d.Name() {
+		case "README", "trim.txt":
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+		removedFiles++
+		removedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return removedFiles, removedBytes, xerrors.Errorf("cannot trim Go build cache: %w", err)
+	}
+	return removedFiles, removedBytes, nil
+}
+
+// CleanModuleCache removes the module cache entirely. The go command makes the module cache read-only,
+// hence we have it remove the cache itself.
+func (c GoCaches) CleanModuleCache() error {
+	if _, err := os.Stat(c.Module); os.IsNotExist(err) {
+		return nil
+	}
+
+	cmd := exec.Command("go", "clean", "-modcache")
+	cmd.Env = append(os.Environ(), c.Env()...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return xerrors.Errorf("cannot clean Go module cache: %w: %s", err, string(out))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package turbocache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/khulnasoft/turbocache/pkg/turbocache"
+)
+
+func TestGoCachesTrim(t *testing.T) {
+	caches := turbocache.GoCaches{
+		Build:  filepath.Join(t.TempDir(), "build"),
+		Module: filepath.Join(t.TempDir(), "mod"),
+	}
+	err := caches.Ensure()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		old = time.Now().Add(-10 * 24 * time.Hour)
+		fns = map[string]time.Time{
+			"README":      old,
+			"trim.txt":    old,
+			"00/stale-a":  old,
+			"00/stale-d":  old,
+			"01/recent-a": time.Now(),
+		}
+	)
+	for fn, mtime := range fns {
+		fn = filepath.Join(caches.Build, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(fn, []byte("content"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(fn, mtime, mtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, size, err := caches.Trim(5 * 24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 || size != 14 {
+		t.Errorf("expected to remove 2 files with 14 bytes, removed %d files with %d bytes", files, size)
+	}
+	for fn := range fns {
+		_, err := os.Stat(filepath.Join(caches.Build, fn))
+		removed := os.IsNotExist(err)
+		if expected := filepath.Dir(fn) == "00"; removed != expected {
+			t.Errorf("%s: expected removed=%v, got %v", fn, expected, removed)
+		}
+	}
+}
@@ -2,17 +2,21 @@ package turbocache
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/minio/highwayhash"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v3"
 
@@ -25,6 +29,15 @@ type Arguments map[string]string
 var (
 	// buildArgRegexp is the regexp to find build arguments
 	buildArgRegexp = regexp.MustCompile(`\$\{(\w+)\}`)
+
+	// goToolchainRegexp matches the names of Go toolchains, e.g. go1.22.5 or go1.23rc1
+	goToolchainRegexp = regexp.MustCompile(`^go1(\.\d+){1,2}((rc|beta)\d+)?$`)
+	// pluginPackageTypeRegexp matches the package types builder plugins can provide
+	pluginPackageTypeRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	// namedOutputRegexp matches the names of named outputs
+	namedOutputRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	// matrixNameRegexp matches the matrix values which can become part of a derived package name
+	matrixNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 )
 
 const (
@@ -38,6 +51,9 @@ const (
 	// BuildinArgGitCommitShort is the shortened version of BuildinArgGitCommit to the first 7 characters
 	BuildinArgGitCommitShort = "__git_commit_short"
 
+	// BuiltinArgVariant is a builtin argument/variable which contains the name of the selected variant, or is empty if no variant is selected
+	BuiltinArgVariant = "__variant"
+
 	// contentHashKey is the key we use to hash source files. Change this key and you'll break all past versions of all turbocache builds ever.
 	contentHashKey = "0340f3c8947cad7875140f4c4af7c62b43131dc2a8c7fc4628f0685e369a3b0b"
 )
@@ -97,6 +113,177 @@ func replaceBuildArguments(fc []byte, args Arguments) []byte {
 	})
 }
 
+// expandPackageMatrices replaces every package with a matrix by one package per combination of the matrix values.
+// The values are substituted like build arguments. Unless the package name references a matrix argument,
+// the values are appended to the name, e.g. app with arch: [amd64, arm64] becomes app-amd64 and app-arm64.
+func expandPackageMatrices(fc []byte) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(fc, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fc, nil
+	}
+	pkgs := mappingValue(doc.Content[0], "packages")
+	if pkgs == nil || pkgs.Kind != yaml.SequenceNode {
+		return fc, nil
+	}
+
+	var (
+		expanded []*yaml.Node
+		changed  bool
+	)
+	for _, pkg := range pkgs.Content {
+		matrix := mappingValue(pkg, "matrix")
+		if matrix == nil {
+			expanded = append(expanded, pkg)
+			continue
+		}
+		changed = true
+
+		pkgs, err := expandPackageMatrix(pkg, matrix)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, pkgs...)
+	}
+	if !changed {
+		return fc, nil
+	}
+
+	names := make(map[string]struct{}, len(expanded))
+	for _, pkg := range expanded {
+		name := mappingValue(pkg, "name")
+		if name == nil {
+			continue
+		}
+		if _, exists := names[name.Value]; exists {
+			return nil, xerrors.Errorf("package matrix produces duplicate package %s", name.Value)
+		}
+		names[name.Value] = struct{}{}
+	}
+
+	pkgs.Content = expanded
+	return yaml.Marshal(&doc)
+}
+
+// expandPackageMatrix produces the packages of all combinations of a package matrix
+func expandPackageMatrix(pkg, matrix *yaml.Node) ([]*yaml.Node, error) {
+	name := mappingValue(pkg, "name")
+	if name == nil {
+		return nil, xerrors.Errorf("package matrix requires a package name")
+	}
+	if matrix.Kind != yaml.MappingNode {
+		return nil, xerrors.Errorf("%s: matrix must map argument names to lists of values", name.Value)
+	}
+
+	var (
+		keys         []string
+		combinations = []map[string]*yaml.Node{{}}
+		nameHasArgs  bool
+	)
+	for i := 0; i+1 < len(matrix.Content); i += 2 {
+		key := matrix.Content[i].Value
+		keys = append(keys, key)
+		if strings.Contains(name.Value, "${"+key+"}") {
+			nameHasArgs = true
+		}
+	}
+	for i, key := range keys {
+		values := matrix.Content[2*i+1]
+		if values.Kind != yaml.SequenceNode || len(values.Content) == 0 {
+			return nil, xerrors.Errorf("%s: matrix argument %s needs a list of values", name.Value, key)
+		}
+
+		var next []map[string]*yaml.Node
+		for _, c := range combinations {
+			for _, v := range values.Content {
+				if v.Kind != yaml.ScalarNode {
+					return nil, xerrors.Errorf("%s: values of matrix argument %s must be scalars", name.Value, key)
+				}
+				if strings.ContainsAny(v.Value, "\r\n\t") {
+					return nil, xerrors.Errorf("%s: matrix value %q of %s must not contain line breaks or tabs", name.Value, v.Value, key)
+				}
+				if !nameHasArgs && !matrixNameRegexp.MatchString(v.Value) {
+					return nil, xerrors.Errorf("%s: matrix value %q cannot be part of a package name - reference the matrix arguments in the name instead", name.Value, v.Value)
+				}
+				nc := make(map[string]*yaml.Node, len(c)+1)
+				for k, val := range c {
+					nc[k] = val
+				}
+				nc[key] = v
+				next = append(next, nc)
+			}
+		}
+		combinations = next
+	}
+
+	// the matrix itself is not part of the produced packages
+	tpl := *pkg
+	tpl.Content = nil
+	for i := 0; i+1 < len(pkg.Content); i += 2 {
+		if pkg.Content[i].Value == "matrix" {
+			continue
+		}
+		tpl.Content = append(tpl.Content, pkg.Content[i], pkg.Content[i+1])
+	}
+
+	res := make([]*yaml.Node, 0, len(combinations))
+	for _, c := range combinations {
+		nde := substituteMatrixArguments(&tpl, c)
+		if !nameHasArgs {
+			segs := []string{name.Value}
+			for _, k := range keys {
+				segs = append(segs, c[k].Value)
+			}
+			mappingValue(nde, "name").Value = strings.Join(segs, "-")
+		}
+		res = append(res, nde)
+	}
+	return res, nil
+}
+
+// substituteMatrixArguments returns a copy of nde with the matrix arguments replaced in all its scalars.
+// Scalars which consist of a single argument take on the value including its type, e.g. a bool,
+// whereas all other scalars remain strings. Values thus never change the structure of the package.
+func substituteMatrixArguments(nde *yaml.Node, args map[string]*yaml.Node) *yaml.Node {
+	res := *nde
+	if nde.Kind == yaml.ScalarNode {
+		arg := strings.TrimSuffix(strings.TrimPrefix(nde.Value, "${"), "}")
+		if v, ok := args[arg]; ok && nde.Value == "${"+arg+"}" {
+			res.Value, res.Tag, res.Style = v.Value, v.Tag, v.Style
+			return &res
+		}
+
+		vals := make(Arguments, len(args))
+		for k, v := range args {
+			vals[k] = v.Value
+		}
+		res.Value = string(replaceBuildArguments([]byte(nde.Value), vals))
+		return &res
+	}
+
+	res.Content = make([]*yaml.Node, 0, len(nde.Content))
+	for _, c := range nde.Content {
+		res.Content = append(res.Content, substituteMatrixArguments(c, args))
+	}
+	return &res
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil if there is no such key
+func mappingValue(nde *yaml.Node, key string) *yaml.Node {
+	if nde.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(nde.Content); i += 2 {
+		if nde.Content[i].Value == key {
+			return nde.Content[i+1]
+		}
+	}
+	return nil
+}
+
 // Component contains a single component that we wish to build
 type Component struct {
 	// W is the workspace this component belongs to
@@ -143,9 +330,18 @@ type PackageInternal struct {
 	Dependencies         []string          `yaml:"deps,omitempty"`
 	Layout               map[string]string `yaml:"layout,omitempty"`
 	ArgumentDependencies []string          `yaml:"argdeps,omitempty"`
+	EnvDependencies      []string          `yaml:"envdeps,omitempty"`
 	Environment          []string          `yaml:"env,omitempty"`
 	Ephemeral            bool              `yaml:"ephemeral,omitempty"`
+	Network              PackageNetwork    `yaml:"network,omitempty"`
+	Resources            PackageResources  `yaml:"resources,omitempty"`
 	PreparationCommands  [][]string        `yaml:"prep,omitempty"`
+	// Outputs are globs relative to the build directory which select the files that go into the build artifact.
+	// Without outputs the entire build directory becomes the artifact.
+	Outputs []string `yaml:"outputs,omitempty"`
+	// NamedOutputs are parts of the build artifact which are stored as cache objects of their own. Each is selected by globs
+	// relative to the artifact root. Packages can depend on a single named output using component:package#name.
+	NamedOutputs map[string][]string `yaml:"namedOutputs,omitempty"`
 }
 
 // Package is a single buildable artifact within a component
@@ -164,6 +360,13 @@ type Package struct {
 	layout           map[*Package]string
 	originalSources  []string
 	fullNameOverride string
+	// goModuleFiles are the go.mod and go.sum files of all Go packages in the workspace, if this
+	// is a modcache package with workspaceModules set
+	goModuleFiles []string
+	// namedOutputs are the packages of the named outputs, see newNamedOutputPackage
+	namedOutputs map[string]*Package
+	// outputOf is the package this named output package belongs to
+	outputOf *Package
 }
 
 // link connects resolves the references to the dependencies
@@ -176,7 +379,7 @@ func (p *Package) link(idx map[string]*Package) error {
 	p.dependencies = make([]*Package, len(p.Dependencies))
 	p.layout = make(map[*Package]string)
 	for i, dep := range p.Dependencies {
-		deppkg, ok := idx[dep]
+		deppkg, ok := lookupPackage(idx, dep)
 		if !ok {
 			return PackageNotFoundErr{dep}
 		}
@@ -191,6 +394,51 @@ func (p *Package) link(idx map[string]*Package) error {
 	return nil
 }
 
+// lookupPackage finds a package in the index. Named outputs are referenced as component:package#name.
+func lookupPackage(idx map[string]*Package, name string) (*Package, bool) {
+	if pkg, ok := idx[name]; ok {
+		return pkg, true
+	}
+	owner, output, found := strings.Cut(name, "#")
+	if !found {
+		return nil, false
+	}
+	pkg, ok := idx[owner]
+	if !ok {
+		return nil, false
+	}
+	out, ok := pkg.namedOutputs[output]
+	return out, ok
+}
+
+// newNamedOutputPackage produces the package of a named output. It depends on the package it belongs to,
+// and its build selects the files of the named output from that package's build artifact.
+func newNamedOutputPackage(owner *Package, name string) *Package {
+	globs := owner.NamedOutputs[name]
+	// the definition makes the globs version relevant
+	def, _ := yaml.Marshal(map[string]interface{}{"namedOutput": name, "globs": globs})
+	return &Package{
+		C: owner.C,
+		PackageInternal: PackageInternal{
+			Name:         owner.Name + "#" + name,
+			Type:         GenericPackage,
+			Dependencies: []string{owner.FullName()},
+			Ephemeral:    owner.Ephemeral,
+			Outputs:      globs,
+		},
+		Config:       GenericPkgConfig{},
+		Definition:   def,
+		dependencies: []*Package{owner},
+		layout:       map[*Package]string{owner: owner.FilesystemSafeName()},
+		outputOf:     owner,
+	}
+}
+
+// NamedOutput returns the package of a named output, or nil if this package has no such output
+func (p *Package) NamedOutput(name string) *Package {
+	return p.namedOutputs[name]
+}
+
 func (p *Package) findCycle() ([]string, error) {
 	var (
 		walk  func(pkg *Package) ([]string, error)
@@ -246,6 +494,7 @@ func (p *Package) GetDependencies() []*Package {
 }
 
 // GetTransitiveDependencies returns all transitive dependencies of a package.
+// The artifact of a named output is self-contained, hence the dependencies of the package it belongs to are not included.
 func (p *Package) GetTransitiveDependencies() []*Package {
 	idx := make(map[string]*Package)
 	queue := []*Package{p}
@@ -258,6 +507,9 @@ func (p *Package) GetTransitiveDependencies() []*Package {
 		}
 
 		idx[dep.FullName()] = dep
+		if dep.outputOf != nil && dep != p {
+			continue
+		}
 		queue = append(queue, dep.dependencies...)
 	}
 
@@ -280,7 +532,7 @@ func (p *Package) Dependants() []*Package {
 	for _, wp := range p.C.W.Packages {
 		var isdep bool
 		for _, dep := range wp.GetDependencies() {
-			if dep.FullName() == p.FullName() {
+			if dep.FullName() == p.FullName() || (dep.outputOf != nil && dep.outputOf.FullName() == p.FullName()) {
 				isdep = true
 				break
 			}
@@ -300,7 +552,7 @@ func (p *Package) TransitiveDependants() []*Package {
 	for _, wp := range p.C.W.Packages {
 		var isdep bool
 		for _, dep := range wp.GetTransitiveDependencies() {
-			if dep.FullName() == p.FullName() {
+			if dep.FullName() == p.FullName() || (dep.outputOf != nil && dep.outputOf.FullName() == p.FullName()) {
 				isdep = true
 				break
 			}
@@ -348,6 +600,55 @@ func (p *Package) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 	p.Config = cfg
 
+	err = validateOutputs(tpe.Type, cfg, tpe.Outputs)
+	if err != nil {
+		return err
+	}
+	for name, globs := range tpe.NamedOutputs {
+		if !namedOutputRegexp.MatchString(name) {
+			return xerrors.Errorf("invalid named output %q: names may only contain letters, digits, - and _", name)
+		}
+		if len(globs) == 0 {
+			return xerrors.Errorf("named output %s needs at least one glob", name)
+		}
+		err = validateOutputGlobs(globs)
+		if err != nil {
+			return xerrors.Errorf("named output %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateOutputs ensures the outputs of a package are valid globs and supported by its type
+func validateOutputs(tpe PackageType, cfg PackageConfig, outputs []string) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	switch tpe {
+	case GenericPackage:
+	case GoPackage:
+		if c, ok := cfg.(GoPkgConfig); ok && c.Packaging == GoModCache {
+			return xerrors.Errorf("outputs are not supported with %s packaging", GoModCache)
+		}
+	default:
+		return xerrors.Errorf("outputs are only supported by %s and %s packages", GenericPackage, GoPackage)
+	}
+	return validateOutputGlobs(outputs)
+}
+
+// validateOutputGlobs ensures output globs are valid and stay within the directory they select from
+func validateOutputGlobs(outputs []string) error {
+	for _, o := range outputs {
+		if o == "" || filepath.IsAbs(o) || o == ".." || strings.HasPrefix(o, "../") {
+			return xerrors.Errorf("output %q must be a glob relative to the build directory", o)
+		}
+		for _, segment := range strings.Split(o, "/") {
+			if _, err := filepath.Match(segment, ""); err != nil {
+				return xerrors.Errorf("invalid output %q: %w", o, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -381,6 +682,37 @@ func unmarshalTypeDependentConfig(tpe PackageType, unmarshal func(interface{}) e
 			return nil, err
 		}
 		return cfg.Config, nil
+	case RustPackage:
+		var cfg struct {
+			Config RustPkgConfig `yaml:"config"`
+		}
+		if err := unmarshal(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Config.Packaging == "" {
+			cfg.Config.Packaging = RustBin
+		}
+		if cfg.Config.Profile == "" {
+			cfg.Config.Profile = "release"
+		}
+		if err := cfg.Config.Validate(); err != nil {
+			return nil, err
+		}
+		return cfg.Config, nil
+	case PythonPackage:
+		var cfg struct {
+			Config PythonPkgConfig `yaml:"config"`
+		}
+		if err := unmarshal(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Config.Linter == "" {
+			cfg.Config.Linter = PythonLinterRuff
+		}
+		if err := cfg.Config.Validate(); err != nil {
+			return nil, err
+		}
+		return cfg.Config, nil
 	case DockerPackage:
 		var cfg struct {
 			Config DockerPkgConfig `yaml:"config"`
@@ -391,6 +723,12 @@ func unmarshalTypeDependentConfig(tpe PackageType, unmarshal func(interface{}) e
 		if cfg.Config.Dockerfile == "" {
 			cfg.Config.Dockerfile = "Dockerfile"
 		}
+		if cfg.Config.Backend == "" {
+			cfg.Config.Backend = DockerBackendDocker
+		}
+		if err := cfg.Config.Validate(); err != nil {
+			return nil, err
+		}
 		return cfg.Config, nil
 	case GenericPackage:
 		var cfg struct {
@@ -400,13 +738,25 @@ func unmarshalTypeDependentConfig(tpe PackageType, unmarshal func(interface{}) e
 			return nil, err
 		}
 		return cfg.Config, nil
-	default:
+	case "":
 		return nil, xerrors.Errorf("unknown package type \"%s\"", tpe)
+	default:
+		// Whether a plugin provides this type is checked once the workspace is loaded
+		var cfg struct {
+			Config PluginPkgConfig `yaml:"config"`
+		}
+		if err := unmarshal(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Config == nil {
+			cfg.Config = PluginPkgConfig{}
+		}
+		return cfg.Config, nil
 	}
 }
 
 // PackageConfig is the YAML unmarshalling config type of packages.
-// This is one of YarnPkgConfig, GoPkgConfig, DockerPkgConfig or GenericPkgConfig.
+// This is one of YarnPkgConfig, GoPkgConfig, RustPkgConfig, PythonPkgConfig, DockerPkgConfig, GenericPkgConfig or PluginPkgConfig.
 type PackageConfig interface {
 	AdditionalSources(workspaceOrigin string) []string
 }
@@ -417,7 +767,13 @@ type YarnPkgConfig struct {
 	TSConfig  string        `yaml:"tsconfig"`
 	Packaging YarnPackaging `yaml:"packaging,omitempty"`
 	DontTest  bool          `yaml:"dontTest,omitempty"`
-	Commands  struct {
+	// MinCoverage is the test coverage in percent below which the test phase fails
+	MinCoverage int `yaml:"minCoverage,omitempty"`
+	// CoverageDir is the directory the tests write their istanbul coverage-summary.json or lcov.info to. Defaults to coverage.
+	CoverageDir string `yaml:"coverageDir,omitempty"`
+	// PackageManager overrides the package manager configured for the workspace
+	PackageManager JSPackageManager `yaml:"packageManager,omitempty"`
+	Commands       struct {
 		Install []string `yaml:"install,omitempty"`
 		Build   []string `yaml:"build,omitempty"`
 		Test    []string `yaml:"test,omitempty"`
@@ -434,7 +790,21 @@ func (cfg YarnPkgConfig) Validate() error {
 	default:
 		return xerrors.Errorf("unknown packaging: %s", cfg.Packaging)
 	}
+	if filepath.IsAbs(cfg.CoverageDir) {
+		return xerrors.Errorf("coverageDir must be relative to the component root")
+	}
+
+	return validateMinCoverage(cfg.MinCoverage, cfg.DontTest)
+}
 
+// validateMinCoverage ensures a minimum test coverage is a percentage, and not configured for packages without tests
+func validateMinCoverage(minCoverage int, dontTest bool) error {
+	if minCoverage < 0 || minCoverage > 100 {
+		return xerrors.Errorf("minCoverage must be between 0 and 100")
+	}
+	if minCoverage > 0 && dontTest {
+		return xerrors.Errorf("minCoverage and dontTest are exclusive - use one or the other")
+	}
 	return nil
 }
 
@@ -452,6 +822,35 @@ const (
 	YarnArchive YarnPackaging = "archive"
 )
 
+// JSPackageManager is the package manager used to build yarn packages
+type JSPackageManager string
+
+const (
+	// JSPackageManagerYarn uses Yarn v1. This is the default.
+	JSPackageManagerYarn JSPackageManager = "yarn"
+	// JSPackageManagerPNPM uses pnpm
+	JSPackageManagerPNPM JSPackageManager = "pnpm"
+	// JSPackageManagerNPM uses npm
+	JSPackageManagerNPM JSPackageManager = "npm"
+)
+
+// UnmarshalYAML unmarshals and validates a package manager
+func (pm *JSPackageManager) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var val string
+	err = unmarshal(&val)
+	if err != nil {
+		return
+	}
+
+	*pm = JSPackageManager(val)
+	switch *pm {
+	case JSPackageManagerYarn, JSPackageManagerPNPM, JSPackageManagerNPM:
+	default:
+		return xerrors.Errorf("invalid package manager: %s", val)
+	}
+	return
+}
+
 // AdditionalSources returns a list of unresolved sources coming in through this configuration
 func (cfg YarnPkgConfig) AdditionalSources(workspaceOrigin string) []string {
 	var res []string
@@ -476,6 +875,14 @@ type GoPkgConfig struct {
 	LintCommand    []string    `yaml:"lintCommand,omitempty"`
 	GoVersion      string      `yaml:"goVersion,omitempty"`
 	GoMod          string      `yaml:"goMod,omitempty"`
+	// Platforms are the GOOS/GOARCH pairs app packages are built for, e.g. linux/amd64.
+	// If empty, we build for the host platform.
+	Platforms []string `yaml:"platforms,omitempty"`
+	// WorkspaceModules makes a modcache package download the modules of all Go packages in the workspace,
+	// rather than those of its own go.mod.
+	WorkspaceModules bool `yaml:"workspaceModules,omitempty"`
+	// MinCoverage is the statement coverage in percent below which the test phase fails
+	MinCoverage int `yaml:"minCoverage,omitempty"`
 }
 
 // Validate ensures this config can be acted upon/is valid
@@ -483,9 +890,16 @@ func (cfg GoPkgConfig) Validate() error {
 	switch cfg.Packaging {
 	case GoLibrary:
 	case GoApp:
+	case GoModCache:
+		if len(cfg.BuildCommand) != 0 || len(cfg.BuildFlags) != 0 {
+			return xerrors.Errorf("%s packaging does not build anything - buildCommand and buildFlags are not supported", GoModCache)
+		}
 	default:
 		return xerrors.Errorf("unknown packaging: %s", cfg.Packaging)
 	}
+	if cfg.WorkspaceModules && cfg.Packaging != GoModCache {
+		return xerrors.Errorf("workspaceModules is only supported for %s packaging", GoModCache)
+	}
 
 	if len(cfg.BuildCommand) != 0 {
 		if len(cfg.BuildFlags) > 0 {
@@ -496,6 +910,30 @@ func (cfg GoPkgConfig) Validate() error {
 		}
 	}
 
+	if cfg.GoVersion != "" && !goToolchainRegexp.MatchString(cfg.Toolchain()) {
+		return xerrors.Errorf("invalid goVersion \"%s\": must name a Go release, e.g. go1.22.5", cfg.GoVersion)
+	}
+
+	if len(cfg.Platforms) > 0 {
+		if cfg.Packaging != GoApp {
+			return xerrors.Errorf("platforms are only supported for %s packaging", GoApp)
+		}
+		if len(cfg.BuildCommand) != 0 {
+			return xerrors.Errorf("buildCommand and platforms are exclusive - use one or the other")
+		}
+	}
+	seen := make(map[string]struct{}, len(cfg.Platforms))
+	for _, p := range cfg.Platforms {
+		goos, goarch, ok := strings.Cut(p, "/")
+		if !ok || goos == "" || goarch == "" || strings.ContainsAny(goarch, "/ ") {
+			return xerrors.Errorf("invalid platform \"%s\": must be GOOS/GOARCH, e.g. linux/amd64", p)
+		}
+		if _, exists := seen[p]; exists {
+			return xerrors.Errorf("duplicate platform: %s", p)
+		}
+		seen[p] = struct{}{}
+	}
+
 	if cfg.GoMod != "" {
 		if filepath.IsAbs(cfg.GoMod) {
 			return xerrors.Errorf("goMod must be relative to the component root")
@@ -505,7 +943,20 @@ func (cfg GoPkgConfig) Validate() error {
 		}
 	}
 
-	return nil
+	return validateMinCoverage(cfg.MinCoverage, cfg.DontTest)
+}
+
+// Toolchain returns the name of the Go toolchain the GoVersion refers to, e.g. go1.22.5
+func (cfg GoPkgConfig) Toolchain() string {
+	if cfg.GoVersion == "" || strings.HasPrefix(cfg.GoVersion, "go") {
+		return cfg.GoVersion
+	}
+	return "go" + cfg.GoVersion
+}
+
+// goPlatformDir returns the directory the binaries built for a GOOS/GOARCH platform are placed in, e.g. linux_amd64
+func goPlatformDir(platform string) string {
+	return strings.ReplaceAll(platform, "/", "_")
 }
 
 // GoPackaging configures the packaging method of a Go package
@@ -516,6 +967,9 @@ const (
 	GoLibrary GoPackaging = "library"
 	// GoApp runs go build and tars the build directory
 	GoApp GoPackaging = "app"
+	// GoModCache runs go mod download and tars the resulting module cache. Go packages which depend
+	// on such a package build against that module cache without network access.
+	GoModCache GoPackaging = "modcache"
 )
 
 // AdditionalSources returns a list of unresolved sources coming in through this configuration
@@ -537,6 +991,95 @@ func (cfg GoPkgConfig) AdditionalSources(workspaceOrigin string) []string {
 	return res
 }
 
+// RustPkgConfig configures a Rust package
+type RustPkgConfig struct {
+	Packaging RustPackaging `yaml:"packaging,omitempty"`
+	Features  []string      `yaml:"features,omitempty"`
+	Profile   string        `yaml:"profile,omitempty"`
+	DontTest  bool          `yaml:"dontTest,omitempty"`
+	DontLint  bool          `yaml:"dontLint,omitempty"`
+}
+
+// Validate ensures this config can be acted upon/is valid
+func (cfg RustPkgConfig) Validate() error {
+	switch cfg.Packaging {
+	case RustBin:
+	case RustLib:
+	default:
+		return xerrors.Errorf("unknown packaging: %s", cfg.Packaging)
+	}
+
+	for _, f := range cfg.Features {
+		if f == "" || strings.ContainsAny(f, ", ") {
+			return xerrors.Errorf("invalid feature \"%s\": list each feature separately", f)
+		}
+	}
+
+	return nil
+}
+
+// ProfileDir returns the directory within target/ cargo places the build output of the profile in
+func (cfg RustPkgConfig) ProfileDir() string {
+	switch cfg.Profile {
+	case "dev", "test":
+		return "debug"
+	case "bench":
+		return "release"
+	default:
+		return cfg.Profile
+	}
+}
+
+// RustPackaging configures the packaging method of a Rust package
+type RustPackaging string
+
+const (
+	// RustBin runs cargo build and packages the binaries of the crate in bin/
+	RustBin RustPackaging = "bin"
+	// RustLib packages the sources of the crate so that other Rust packages can depend on it
+	RustLib RustPackaging = "lib"
+)
+
+// AdditionalSources returns a list of unresolved sources coming in through this configuration
+func (cfg RustPkgConfig) AdditionalSources(workspaceOrigin string) []string {
+	return []string{}
+}
+
+// PythonPkgConfig configures a Python package
+type PythonPkgConfig struct {
+	Linter        PythonLinter `yaml:"linter,omitempty"`
+	BuildRequires []string     `yaml:"buildRequires,omitempty"`
+	DontTest      bool         `yaml:"dontTest,omitempty"`
+	DontLint      bool         `yaml:"dontLint,omitempty"`
+}
+
+// Validate ensures this config can be acted upon/is valid
+func (cfg PythonPkgConfig) Validate() error {
+	switch cfg.Linter {
+	case PythonLinterRuff:
+	case PythonLinterFlake8:
+	default:
+		return xerrors.Errorf("unknown linter: %s", cfg.Linter)
+	}
+
+	return nil
+}
+
+// PythonLinter is the linter used to lint a Python package
+type PythonLinter string
+
+const (
+	// PythonLinterRuff runs `ruff check`
+	PythonLinterRuff PythonLinter = "ruff"
+	// PythonLinterFlake8 runs `python -m flake8`
+	PythonLinterFlake8 PythonLinter = "flake8"
+)
+
+// AdditionalSources returns a list of unresolved sources coming in through this configuration
+func (cfg PythonPkgConfig) AdditionalSources(workspaceOrigin string) []string {
+	return []string{}
+}
+
 // DockerPkgConfig configures a Docker package
 type DockerPkgConfig struct {
 	Dockerfile string            `yaml:"dockerfile,omitempty"`
@@ -544,6 +1087,106 @@ type DockerPkgConfig struct {
 	BuildArgs  map[string]string `yaml:"buildArgs,omitempty"`
 	Squash     bool              `yaml:"squash,omitempty"`
 	Metadata   map[string]string `yaml:"metadata,omitempty"`
+	Backend    DockerBackend     `yaml:"backend,omitempty"`
+	Platforms  []string          `yaml:"platforms,omitempty"`
+	Secrets    []DockerSecret    `yaml:"secrets,omitempty"`
+}
+
+// Validate ensures this config can be acted upon/is valid
+func (cfg DockerPkgConfig) Validate() error {
+	switch cfg.Backend {
+	case DockerBackendDocker:
+		if len(cfg.Platforms) > 0 {
+			return xerrors.Errorf("platforms require the %s backend", DockerBackendBuildx)
+		}
+		if len(cfg.Secrets) > 0 {
+			return xerrors.Errorf("secrets require the %s backend", DockerBackendBuildx)
+		}
+	case DockerBackendBuildx:
+		if cfg.Squash {
+			return xerrors.Errorf("squash is not supported by the %s backend", DockerBackendBuildx)
+		}
+	default:
+		return xerrors.Errorf("unknown backend: %s", cfg.Backend)
+	}
+
+	for _, p := range cfg.Platforms {
+		if p == "" || strings.Contains(p, ",") {
+			return xerrors.Errorf("invalid platform \"%s\": list each platform separately", p)
+		}
+	}
+	ids := make(map[string]struct{}, len(cfg.Secrets))
+	for _, s := range cfg.Secrets {
+		if s.ID == "" {
+			return xerrors.Errorf("secrets must have an id")
+		}
+		if _, exists := ids[s.ID]; exists {
+			return xerrors.Errorf("duplicate secret: %s", s.ID)
+		}
+		ids[s.ID] = struct{}{}
+		if (s.Src == "") == (s.Env == "") {
+			return xerrors.Errorf("secret %s must have either src or env", s.ID)
+		}
+	}
+
+	return nil
+}
+
+// DockerBackend is the tool docker packages are built with
+type DockerBackend string
+
+const (
+	// DockerBackendDocker uses the classic "docker build"
+	DockerBackendDocker DockerBackend = "docker"
+	// DockerBackendBuildx builds using BuildKit through "docker buildx build"
+	DockerBackendBuildx DockerBackend = "buildx"
+)
+
+// DockerBuilder is the tool which builds the images of docker packages
+type DockerBuilder string
+
+const (
+	// DockerBuilderDocker builds images using the Docker daemon. This is the default.
+	DockerBuilderDocker DockerBuilder = "docker"
+	// DockerBuilderPodman builds images using podman, which needs no daemon and can run rootless
+	DockerBuilderPodman DockerBuilder = "podman"
+	// DockerBuilderBuildah builds images using buildah, which needs no daemon and can run rootless
+	DockerBuilderBuildah DockerBuilder = "buildah"
+)
+
+// UnmarshalYAML unmarshals and validates a docker builder
+func (b *DockerBuilder) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var val string
+	err = unmarshal(&val)
+	if err != nil {
+		return
+	}
+
+	*b = DockerBuilder(val)
+	switch *b {
+	case DockerBuilderDocker, DockerBuilderPodman, DockerBuilderBuildah:
+	default:
+		return xerrors.Errorf("invalid docker builder: %s", val)
+	}
+	return
+}
+
+// DockerSecret is a build secret available to RUN --mount=type=secret instructions.
+// Secrets do not contribute to the package version.
+type DockerSecret struct {
+	ID string `yaml:"id"`
+	// Src is the file containing the secret
+	Src string `yaml:"src,omitempty"`
+	// Env is the environment variable containing the secret
+	Env string `yaml:"env,omitempty"`
+}
+
+// BuildxFlag returns the value of the --secret flag of docker buildx build for this secret
+func (s DockerSecret) BuildxFlag() string {
+	if s.Env != "" {
+		return fmt.Sprintf("id=%s,env=%s", s.ID, s.Env)
+	}
+	return fmt.Sprintf("id=%s,src=%s", s.ID, s.Src)
 }
 
 // AdditionalSources returns a list of unresolved sources coming in through this configuration
@@ -573,6 +1216,12 @@ const (
 	// GoPackage runs go build and produces a binary file
 	GoPackage PackageType = "go"
 
+	// RustPackage runs cargo build and produces binaries or a crate other Rust packages can depend on
+	RustPackage PackageType = "rust"
+
+	// PythonPackage builds a wheel of a Python project
+	PythonPackage PackageType = "python"
+
 	// DockerPackage runs docker build
 	DockerPackage PackageType = "docker"
 
@@ -589,14 +1238,132 @@ func (p *PackageType) UnmarshalYAML(unmarshal func(interface{}) error) (err erro
 	}
 
 	*p = PackageType(val)
-	switch *p {
-	case YarnPackage, GoPackage, DockerPackage, GenericPackage:
+	if !isBuiltinPackageType(*p) && !pluginPackageTypeRegexp.MatchString(val) {
+		return fmt.Errorf("invalid package type: %s", val)
+	}
+	return
+}
+
+// isBuiltinPackageType returns true if turbocache can build packages of this type without a plugin
+func isBuiltinPackageType(tpe PackageType) bool {
+	switch tpe {
+	case YarnPackage, GoPackage, RustPackage, PythonPackage, DockerPackage, GenericPackage:
+		return true
 	default:
-		return fmt.Errorf("invalid package type: %s", err)
+		return false
+	}
+}
+
+// PackageNetwork describes the network access a package build has
+type PackageNetwork string
+
+const (
+	// NetworkUnspecified grants full network access
+	NetworkUnspecified PackageNetwork = ""
+
+	// NetworkFull grants full network access
+	NetworkFull PackageNetwork = "full"
+
+	// NetworkNone disables network access for all build phases
+	NetworkNone PackageNetwork = "none"
+
+	// NetworkPullOnly grants network access during the pull phase only
+	NetworkPullOnly PackageNetwork = "pull-only"
+)
+
+// UnmarshalYAML unmarshals and validates a package network setting
+func (n *PackageNetwork) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var val string
+	err = unmarshal(&val)
+	if err != nil {
+		return
+	}
+
+	*n = PackageNetwork(val)
+	switch *n {
+	case NetworkUnspecified, NetworkFull, NetworkNone, NetworkPullOnly:
+	default:
+		return fmt.Errorf("invalid network setting: %s", val)
 	}
 	return
 }
 
+// AllowedDuring returns true if a package build may access the network during the build phase
+func (n PackageNetwork) AllowedDuring(phase PackageBuildPhase) bool {
+	switch n {
+	case NetworkNone:
+		return false
+	case NetworkPullOnly:
+		return phase == PackageBuildPhasePull
+	default:
+		return true
+	}
+}
+
+// PackageResources limits the resources the build commands of a package can use
+type PackageResources struct {
+	// Memory is the maximum amount of memory the build commands can use, e.g. 512M or 4Gi
+	Memory MemoryQuantity `yaml:"memory,omitempty"`
+	// CPU is the number of CPUs the build commands can use, e.g. 1.5
+	CPU float64 `yaml:"cpu,omitempty"`
+	// PIDs is the maximum number of processes the build commands can run at once
+	PIDs int64 `yaml:"pids,omitempty"`
+}
+
+// IsLimited returns true if any resource limit is configured
+func (r PackageResources) IsLimited() bool {
+	return r.Memory > 0 || r.CPU > 0 || r.PIDs > 0
+}
+
+// MemoryQuantity is an amount of memory in bytes
+type MemoryQuantity uint64
+
+var memoryQuantityUnits = map[string]uint64{
+	"":   1,
+	"K":  1000,
+	"M":  1000 * 1000,
+	"G":  1000 * 1000 * 1000,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+}
+
+var memoryQuantityRegexp = regexp.MustCompile(`^(\d+)([KMG]i?)?$`)
+
+// UnmarshalYAML unmarshals and validates a memory quantity
+func (q *MemoryQuantity) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var val string
+	err = unmarshal(&val)
+	if err != nil {
+		return
+	}
+
+	res, err := ParseMemoryQuantity(val)
+	if err != nil {
+		return err
+	}
+	*q = res
+	return nil
+}
+
+// ParseMemoryQuantity parses a memory quantity like 512M or 4Gi into a number of bytes.
+// The units K, M and G are powers of 1000, Ki, Mi and Gi powers of 1024. Quantities which exceed 64 bits are rejected.
+func ParseMemoryQuantity(val string) (MemoryQuantity, error) {
+	m := memoryQuantityRegexp.FindStringSubmatch(strings.TrimSpace(val))
+	if m == nil {
+		return 0, xerrors.Errorf("invalid memory quantity %q: must be a number of bytes with an optional unit (K, M, G, Ki, Mi, Gi)", val)
+	}
+	n, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return 0, xerrors.Errorf("invalid memory quantity %q: %w", val, err)
+	}
+	unit := memoryQuantityUnits[m[2]]
+	if n > math.MaxUint64/unit {
+		return 0, xerrors.Errorf("invalid memory quantity %q: too large", val)
+	}
+	return MemoryQuantity(n * unit), nil
+}
+
 type packageVariantInternal struct {
 	Name    string `yaml:"name"`
 	Sources struct {
@@ -778,6 +1545,7 @@ func (p *Package) FilesystemSafeName() string {
 func FilesystemSafeName(fn string) string {
 	res := strings.Replace(fn, "/", "-", -1)
 	res = strings.Replace(res, ":", "--", -1)
+	res = strings.Replace(res, "#", "--", -1)
 	// components in the workspace root would otherwise start with - which breaks a lot of shell commands
 	res = strings.TrimLeft(res, "-")
 	return res
@@ -798,7 +1566,7 @@ func (p *Package) resolveBuiltinVariables() error {
 		case BuildinArgGitCommit, BuildinArgGitCommitShort:
 			foundGitVar = true
 			fallthrough
-		case BuiltinArgPackageVersion:
+		case BuiltinArgPackageVersion, BuiltinArgVariant:
 			found = true
 		}
 	}
@@ -813,6 +1581,10 @@ func (p *Package) resolveBuiltinVariables() error {
 	}
 	builtinArgs := map[string]string{
 		BuiltinArgPackageVersion: version,
+		BuiltinArgVariant:        "",
+	}
+	if p.C != nil && p.C.W != nil && p.C.W.SelectedVariant != nil {
+		builtinArgs[BuiltinArgVariant] = p.C.W.SelectedVariant.Name
 	}
 	if foundGitVar {
 		err = resolveBuiltinGitVariables(p, builtinArgs)
@@ -872,8 +1644,12 @@ func (p *Package) ContentManifest() ([]string, error) {
 	}
 
 	// TODO: parallelize
-	res := make([]string, len(p.Sources))
-	for i, src := range p.Sources {
+	srcs := p.Sources
+	if len(p.goModuleFiles) > 0 {
+		srcs = append(append([]string{}, p.Sources...), p.goModuleFiles...)
+	}
+	res := make([]string, len(srcs))
+	for i, src := range srcs {
 		if stat, err := os.Stat(src); err != nil {
 			return nil, err
 		} else if stat.IsDir() {
@@ -913,13 +1689,120 @@ func (p *Package) ContentManifest() ([]string, error) {
 	return res, nil
 }
 
+// JSPackageManager returns the package manager used to build this package, if it is a yarn package
+func (p *Package) JSPackageManager() JSPackageManager {
+	if cfg, ok := p.Config.(YarnPkgConfig); ok && cfg.PackageManager != "" {
+		return cfg.PackageManager
+	}
+	if p.C != nil && p.C.W != nil && p.C.W.JavaScript.PackageManager != "" {
+		return p.C.W.JavaScript.PackageManager
+	}
+	return JSPackageManagerYarn
+}
+
+// GoToolchain returns the Go toolchain this package is built with if it's pinned using goVersion,
+// or the toolchain directive of its go.mod. Returns an empty string otherwise.
+// The build of the package selects this toolchain using GOTOOLCHAIN.
+func (p *Package) GoToolchain() string {
+	cfg, ok := p.Config.(GoPkgConfig)
+	if !ok {
+		return ""
+	}
+	if cfg.GoVersion != "" {
+		return cfg.Toolchain()
+	}
+
+	fn := p.goModFile()
+	fc, err := os.ReadFile(fn)
+	if err != nil {
+		return ""
+	}
+	mf, err := modfile.Parse(fn, fc, nil)
+	if err != nil || mf.Toolchain == nil {
+		return ""
+	}
+	return mf.Toolchain.Name
+}
+
+// goModFile returns the path of the go.mod file of this Go package
+func (p *Package) goModFile() string {
+	if cfg, ok := p.Config.(GoPkgConfig); ok && cfg.GoMod != "" {
+		return filepath.Join(p.C.Origin, cfg.GoMod)
+	}
+	return filepath.Join(p.C.Origin, "go.mod")
+}
+
+// workspaceGoModuleFiles returns the go.mod and go.sum files of all Go packages in pkgs, but modcache packages
+func workspaceGoModuleFiles(pkgs map[string]*Package) []string {
+	idx := make(map[string]struct{})
+	for _, pkg := range pkgs {
+		cfg, ok := pkg.Config.(GoPkgConfig)
+		if !ok || cfg.Packaging == GoModCache {
+			continue
+		}
+		mod := pkg.goModFile()
+		for _, fn := range []string{mod, strings.TrimSuffix(mod, ".mod") + ".sum"} {
+			if _, err := os.Stat(fn); err != nil {
+				continue
+			}
+			idx[fn] = struct{}{}
+		}
+	}
+
+	res := make([]string, 0, len(idx))
+	for fn := range idx {
+		res = append(res, fn)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// MinCoverage returns the test coverage in percent this package must at least reach, or 0 if there is no such requirement
+func (p *Package) MinCoverage() int {
+	switch cfg := p.Config.(type) {
+	case GoPkgConfig:
+		return cfg.MinCoverage
+	case YarnPkgConfig:
+		return cfg.MinCoverage
+	default:
+		return 0
+	}
+}
+
+// DockerBuilder returns the tool which builds the image of this package
+func (p *Package) DockerBuilder() DockerBuilder {
+	if p.C != nil && p.C.W != nil && p.C.W.Docker.Builder != "" {
+		return p.C.W.Docker.Builder
+	}
+	return DockerBuilderDocker
+}
+
+// environmentManifest returns the workspace environment manifest this package's version depends on.
+// Go packages which are cross-compiled for a list of platforms produce the same output on every host,
+// hence their version does not depend on the host's OS and architecture.
+func (p *Package) environmentManifest() EnvironmentManifest {
+	cfg, ok := p.Config.(GoPkgConfig)
+	if !ok || len(cfg.Platforms) == 0 {
+		return p.C.W.EnvironmentManifest
+	}
+
+	res := make(EnvironmentManifest, 0, len(p.C.W.EnvironmentManifest))
+	for _, e := range p.C.W.EnvironmentManifest {
+		if e.Builtin && (e.Command[0] == builtinEnvManifestGOOS || e.Command[0] == builtinEnvManifestGOARCH) {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
 // WriteVersionManifest writes the manifest whoose hash is the version of this package (see Version())
 func (p *Package) WriteVersionManifest(out io.Writer) error {
 	if p.dependencies == nil {
 		return xerrors.Errorf("package is not linked")
 	}
 
-	envhash, err := p.C.W.EnvironmentManifest.Hash()
+	envhash, err := p.environmentManifest().Hash()
 	if err != nil {
 		return err
 	}
@@ -948,9 +1831,39 @@ func (p *Package) WriteVersionManifest(out io.Writer) error {
 
 	bundle = append(bundle, fmt.Sprintf("environment: %s\n", envhash))
 	bundle = append(bundle, fmt.Sprintf("definition: %s\n", defhash))
+	if pm := p.JSPackageManager(); p.Type == YarnPackage && pm != JSPackageManagerYarn {
+		bundle = append(bundle, fmt.Sprintf("packageManager: %s\n", pm))
+	}
+	if b := p.DockerBuilder(); p.Type == DockerPackage && b != DockerBuilderDocker {
+		bundle = append(bundle, fmt.Sprintf("dockerBuilder: %s\n", b))
+	}
+	if tc := p.GoToolchain(); p.Type == GoPackage && tc != "" {
+		bundle = append(bundle, fmt.Sprintf("goToolchain: %s\n", tc))
+	}
+	if cfg, ok := p.Config.(GoPkgConfig); ok && len(cfg.Platforms) > 0 {
+		bundle = append(bundle, fmt.Sprintf("platforms: %s\n", strings.Join(cfg.Platforms, ",")))
+	}
+	if pl, ok := p.C.W.Plugins[p.Type]; ok {
+		bundle = append(bundle, fmt.Sprintf("plugin: %s %s\n", p.Type, pl.version))
+	}
 	for _, argdep := range p.ArgumentDependencies {
 		bundle = append(bundle, fmt.Sprintf("arg %s\n", argdep))
 	}
+	for _, envdep := range p.EnvDependencyValues() {
+		bundle = append(bundle, fmt.Sprintf("env %s\n", envdep))
+	}
+	if hermetic := p.C.W.Hermetic; hermetic.Enabled {
+		bundle = append(bundle, fmt.Sprintf("hermetic: passEnv=%s\n", strings.Join(hermetic.PassEnv, ",")))
+		if hermetic.HashPassEnv {
+			passEnv, err := passEnvManifest(hermetic.FilterEnvironment(os.Environ()))
+			if err != nil {
+				return err
+			}
+			for _, e := range passEnv {
+				bundle = append(bundle, fmt.Sprintf("passEnv %s\n", e))
+			}
+		}
+	}
 	for _, dep := range p.dependencies {
 		ver, err := dep.Version()
 		if err != nil {
@@ -971,6 +1884,52 @@ func (p *Package) WriteVersionManifest(out io.Writer) error {
 	return nil
 }
 
+// EnvDependencyValues returns the version relevant host environment variables of this package in the form <name>: <sha256 of value>.
+// Much like passEnvManifest we hash the values, as they may well carry credentials.
+// Variables which are not set in the host environment have the value <not-set>.
+func (p *Package) EnvDependencyValues() []string {
+	res := make([]string, 0, len(p.EnvDependencies))
+	for _, name := range p.EnvDependencies {
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			res = append(res, fmt.Sprintf("%s: <not-set>", name))
+			continue
+		}
+		res = append(res, fmt.Sprintf("%s: %x", name, sha256.Sum256([]byte(val))))
+	}
+	return res
+}
+
+// passEnvManifest produces an ordered list of <name>:<hash> entries for the environment variables.
+// We hash the values rather than printing them verbatim because passed-through variables may well carry credentials.
+func passEnvManifest(environ []string) ([]string, error) {
+	key, err := hex.DecodeString(contentHashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		segs := strings.SplitN(kv, "=", 2)
+		if len(segs) != 2 {
+			continue
+		}
+
+		hash, err := highwayhash.New(key)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(hash, segs[1])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, fmt.Sprintf("%s:%s", segs[0], hex.EncodeToString(hash.Sum(nil))))
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
+
 // Version computes the Package version based on the content hash of the sources
 func (p *Package) Version() (string, error) {
 	if p.versionCache != "" {
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestResolveBuiltinGitVariables(t *testing.T) {
@@ -149,7 +152,7 @@ func TestResolveBuiltinVariables(t *testing.T) {
 		ExpectedCfg PackageConfig
 	}{
 		{YarnPackage, YarnPkgConfig{TSConfig: "${__pkg_version}.json", Packaging: YarnLibrary}, nil, YarnPkgConfig{TSConfig: "this-version.json", Packaging: YarnLibrary}},
-		{DockerPackage, DockerPkgConfig{Dockerfile: "turbocache.Dockerfile", Image: []string{"foobar:${__pkg_version}"}}, nil, DockerPkgConfig{Dockerfilturbocacherbocache.Dockerfile", Image: []string{"foobar:this-version"}}},
+		{DockerPackage, DockerPkgConfig{Dockerfile: "turbocache.Dockerfile", Backend: DockerBackendDocker, Image: []string{"foobar:${__pkg_version}"}}, nil, DockerPkgConfig{Dockerfile: "turbocache.Dockerfile", Backend: DockerBackendDocker, Image: []string{"foobar:this-version"}}},
 		{GoPackage, GoPkgConfig{Packaging: GoApp, BuildFlags: []string{"-ldflags", "-X cmd.version=${__pkg_version}"}}, nil, GoPkgConfig{Packaging: GoApp, BuildFlags: []string{"-ldflags", "-X cmd.version=this-version"}}},
 		{GenericPackage, GenericPkgConfig{Commands: [][]string{{"echo", "${__pkg_version}"}}}, nil, GenericPkgConfig{Commands: [][]string{{"echo", "this-version"}}}},
 	}
@@ -310,6 +313,195 @@ func NewTestPackage(name string) *Package {
 	}
 }
 
+func TestNamedOutputs(t *testing.T) {
+	var (
+		lib   = NewTestPackage("lib")
+		tools = NewTestPackage("tools")
+		user  = NewTestPackage("user")
+	)
+	tools.C = lib.C
+	user.C = lib.C
+	tools.dependencies = []*Package{lib}
+	tools.NamedOutputs = map[string][]string{"bin": {"bin/**"}}
+	tools.namedOutputs = map[string]*Package{"bin": newNamedOutputPackage(tools, "bin")}
+	user.Dependencies = []string{"testcomp:tools#bin"}
+	for _, p := range []*Package{lib, tools, user} {
+		lib.C.W.Packages[p.FullName()] = p
+	}
+
+	err := user.link(lib.C.W.Packages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := tools.NamedOutput("bin")
+	if deps := user.GetDependencies(); len(deps) != 1 || deps[0] != bin {
+		t.Fatalf("expected user to depend on the named output, got %v", deps)
+	}
+	if act := bin.FullName(); act != "testcomp:tools#bin" {
+		t.Errorf("unexpected named output name %s", act)
+	}
+	if act := user.BuildLayoutLocation(bin); act != "testcomp--tools--bin" {
+		t.Errorf("unexpected default layout %s", act)
+	}
+
+	var names []string
+	for _, dep := range user.GetTransitiveDependencies() {
+		names = append(names, dep.FullName())
+	}
+	if !reflect.DeepEqual(names, []string{"testcomp:tools#bin"}) {
+		t.Errorf("transitive dependencies must stop at named outputs, got %v", names)
+	}
+	names = names[:0]
+	for _, dep := range bin.GetTransitiveDependencies() {
+		names = append(names, dep.FullName())
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"testcomp:lib", "testcomp:tools"}) {
+		t.Errorf("named outputs must depend on their package, got %v", names)
+	}
+	if dependants := tools.Dependants(); len(dependants) != 1 || dependants[0] != user {
+		t.Errorf("expected user to be a dependant of tools, got %v", dependants)
+	}
+
+	_, ok := lookupPackage(lib.C.W.Packages, "testcomp:tools#docs")
+	if ok {
+		t.Errorf("found named output which does not exist")
+	}
+}
+
+func TestUnmarshalNamedOutputs(t *testing.T) {
+	tests := []struct {
+		Input string
+		Error bool
+	}{
+		{Input: "name: foo\ntype: generic\nnamedOutputs:\n  bin: [\"bin/**\"]\n  test-data: [testdata]"},
+		{Input: "name: foo\ntype: docker\nnamedOutputs:\n  meta: [\"*.json\"]"},
+		{Input: "name: foo\ntype: generic\nnamedOutputs:\n  bin#1: [bin]", Error: true},
+		{Input: "name: foo\ntype: generic\nnamedOutputs:\n  bin: []", Error: true},
+		{Input: "name: foo\ntype: generic\nnamedOutputs:\n  bin: [\"../bin\"]", Error: true},
+	}
+
+	for _, test := range tests {
+		var pkg Package
+		err := yaml.Unmarshal([]byte(test.Input), &pkg)
+		if test.Error && err == nil {
+			t.Errorf("%q: expected error", test.Input)
+		}
+		if !test.Error && err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+		}
+	}
+}
+
+func TestExpandPackageMatrices(t *testing.T) {
+	type pkg struct {
+		Name  string            `yaml:"name"`
+		Env   []string          `yaml:"env"`
+		Args  map[string]string `yaml:"args,omitempty"`
+		Ephem bool              `yaml:"ephemeral,omitempty"`
+	}
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation []pkg
+		Error       bool
+	}{
+		{
+			Name:        "no matrix",
+			Input:       "packages:\n- name: app\n  env: [\"A=${arch}\"]",
+			Expectation: []pkg{{Name: "app", Env: []string{"A=${arch}"}}},
+		},
+		{
+			Name:  "derived names",
+			Input: "packages:\n- name: app\n  matrix:\n    arch: [amd64, arm64]\n    flavor: [oss, ee]\n  env: [\"A=${arch}\", \"F=${flavor}\", \"V=${version}\"]\n- name: other",
+			Expectation: []pkg{
+				{Name: "app-amd64-oss", Env: []string{"A=amd64", "F=oss", "V=${version}"}},
+				{Name: "app-amd64-ee", Env: []string{"A=amd64", "F=ee", "V=${version}"}},
+				{Name: "app-arm64-oss", Env: []string{"A=arm64", "F=oss", "V=${version}"}},
+				{Name: "app-arm64-ee", Env: []string{"A=arm64", "F=ee", "V=${version}"}},
+				{Name: "other"},
+			},
+		},
+		{
+			Name:  "explicit names",
+			Input: "packages:\n- name: ${flavor}-app\n  matrix:\n    platform: [linux/amd64]\n    flavor: [oss, ee]\n  env: [\"P=${platform}\"]",
+			Expectation: []pkg{
+				{Name: "oss-app", Env: []string{"P=linux/amd64"}},
+				{Name: "ee-app", Env: []string{"P=linux/amd64"}},
+			},
+		},
+		{
+			Name:  "yaml special values",
+			Input: "packages:\n- name: app\n  matrix:\n    v: [\"on\", \"1.20\"]\n  env: [\"V=${v}\"]\n  args:\n    v: ${v}\n    w: \"${v}\"",
+			Expectation: []pkg{
+				{Name: "app-on", Env: []string{"V=on"}, Args: map[string]string{"v": "on", "w": "on"}},
+				{Name: "app-1.20", Env: []string{"V=1.20"}, Args: map[string]string{"v": "1.20", "w": "1.20"}},
+			},
+		},
+		{
+			Name:  "yaml indicators",
+			Input: "packages:\n- name: app-${n}\n  matrix:\n    n: [\"1\"]\n    v: [\"a: b, [c] #d\"]\n  env: [\"V=${v}\"]\n  args:\n    v: ${v}",
+			Expectation: []pkg{
+				{Name: "app-1", Env: []string{"V=a: b, [c] #d"}, Args: map[string]string{"v": "a: b, [c] #d"}},
+			},
+		},
+		{
+			Name:  "typed values",
+			Input: "packages:\n- name: app\n  matrix:\n    ephemeral: [true, false]\n  ephemeral: ${ephemeral}",
+			Expectation: []pkg{
+				{Name: "app-true", Ephem: true},
+				{Name: "app-false"},
+			},
+		},
+		{
+			Name:  "multi-line value",
+			Input: "packages:\n- name: ${v}\n  matrix:\n    v: [\"a\\nb\"]",
+			Error: true,
+		},
+		{
+			Name:  "value not fit for names",
+			Input: "packages:\n- name: app\n  matrix:\n    platform: [linux/amd64]",
+			Error: true,
+		},
+		{
+			Name:  "empty values",
+			Input: "packages:\n- name: app\n  matrix:\n    arch: []",
+			Error: true,
+		},
+		{
+			Name:  "duplicate packages",
+			Input: "packages:\n- name: app\n  matrix:\n    arch: [amd64]\n- name: app-amd64",
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			fc, err := expandPackageMatrices([]byte(test.Input))
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected error, got %s", fc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var act struct {
+				Packages []pkg `yaml:"packages"`
+			}
+			err = yaml.Unmarshal(fc, &act)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(act.Packages, test.Expectation) {
+				t.Errorf("expected %v, actual %v", test.Expectation, act.Packages)
+			}
+		})
+	}
+}
+
 func TestCodecovComponentName(t *testing.T) {
 	tests := []struct {
 		Test     string
@@ -329,3 +521,452 @@ func TestCodecovComponentName(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteVersionManifestEnvDeps(t *testing.T) {
+	t.Setenv("TURBOCACHE_TEST_ENVDEP", "foobar")
+
+	pkg := NewTestPackage("pkg")
+	pkg.dependencies = []*Package{}
+	pkg.EnvDependencies = []string{"TURBOCACHE_TEST_ENVDEP", "TURBOCACHE_TEST_ENVDEP_UNSET"}
+
+	var out strings.Builder
+	err := pkg.WriteVersionManifest(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"env TURBOCACHE_TEST_ENVDEP: c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2\n", "env TURBOCACHE_TEST_ENVDEP_UNSET: <not-set>\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("version manifest does not contain %q:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "foobar") {
+		t.Errorf("version manifest contains the value of an envdep:\n%s", out.String())
+	}
+}
+
+func TestWriteVersionManifestPlatforms(t *testing.T) {
+	manifest := func(cfg GoPkgConfig, goos, goarch string) string {
+		pkg := NewTestPackage("pkg")
+		pkg.Type = GoPackage
+		pkg.Config = cfg
+		pkg.dependencies = []*Package{}
+		pkg.C.W.EnvironmentManifest = EnvironmentManifest{
+			{Name: "arch", Command: []string{builtinEnvManifestGOARCH}, Value: goarch, Builtin: true},
+			{Name: "os", Command: []string{builtinEnvManifestGOOS}, Value: goos, Builtin: true},
+		}
+
+		var out strings.Builder
+		err := pkg.WriteVersionManifest(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	cross := GoPkgConfig{Packaging: GoApp, Platforms: []string{"linux/amd64", "darwin/arm64"}}
+	if a, b := manifest(cross, "linux", "amd64"), manifest(cross, "darwin", "arm64"); a != b {
+		t.Errorf("version manifest of a package with platforms depends on the host:\n%s\n%s", a, b)
+	}
+	if m := manifest(cross, "linux", "amd64"); !strings.Contains(m, "platforms: linux/amd64,darwin/arm64\n") {
+		t.Errorf("version manifest does not contain the platforms:\n%s", m)
+	}
+
+	host := GoPkgConfig{Packaging: GoApp}
+	if a, b := manifest(host, "linux", "amd64"), manifest(host, "darwin", "arm64"); a == b {
+		t.Errorf("version manifest of a package without platforms does not depend on the host:\n%s", a)
+	}
+}
+
+func TestPackageNetworkAllowedDuring(t *testing.T) {
+	phases := []PackageBuildPhase{PackageBuildPhasePrep, PackageBuildPhasePull, PackageBuildPhaseLint, PackageBuildPhaseTest, PackageBuildPhaseBuild, PackageBuildPhasePackage}
+	tests := []struct {
+		Network PackageNetwork
+		Allowed []PackageBuildPhase
+	}{
+		{NetworkUnspecified, phases},
+		{NetworkFull, phases},
+		{NetworkNone, nil},
+		{NetworkPullOnly, []PackageBuildPhase{PackageBuildPhasePull}},
+	}
+
+	for _, test := range tests {
+		var act []PackageBuildPhase
+		for _, phase := range phases {
+			if test.Network.AllowedDuring(phase) {
+				act = append(act, phase)
+			}
+		}
+		if !reflect.DeepEqual(act, test.Allowed) {
+			t.Errorf("%q: expected network access during %v, actual: %v", test.Network, test.Allowed, act)
+		}
+	}
+}
+
+func TestParseMemoryQuantity(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation MemoryQuantity
+		Error       bool
+	}{
+		{Input: "1024", Expectation: 1024},
+		{Input: "512M", Expectation: 512 * 1000 * 1000},
+		{Input: "4Gi", Expectation: 4 << 30},
+		{Input: "64Ki", Expectation: 64 << 10},
+		{Input: "4GB", Error: true},
+		{Input: "99999999999Gi", Error: true},
+		{Input: "18446744073709551615", Expectation: 18446744073709551615},
+		{Input: "18446744073709551616", Error: true},
+		{Input: "-1", Error: true},
+		{Input: "", Error: true},
+	}
+
+	for _, test := range tests {
+		act, err := ParseMemoryQuantity(test.Input)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%q: expected error, got %d", test.Input, act)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if act != test.Expectation {
+			t.Errorf("%q: expected %d, actual %d", test.Input, test.Expectation, act)
+		}
+	}
+}
+
+func TestUnmarshalPythonConfig(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation PythonPkgConfig
+		Error       bool
+	}{
+		{Input: "config: {}", Expectation: PythonPkgConfig{Linter: PythonLinterRuff}},
+		{Input: "config:\n  linter: flake8\n  dontTest: true", Expectation: PythonPkgConfig{Linter: PythonLinterFlake8, DontTest: true}},
+		{Input: "config:\n  buildRequires: [setuptools, wheel]", Expectation: PythonPkgConfig{Linter: PythonLinterRuff, BuildRequires: []string{"setuptools", "wheel"}}},
+		{Input: "config:\n  linter: pylint", Error: true},
+	}
+
+	for _, test := range tests {
+		act, err := unmarshalTypeDependentConfig(PythonPackage, func(out interface{}) error {
+			return yaml.Unmarshal([]byte(test.Input), out)
+		})
+		if test.Error {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", test.Input, act)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if !reflect.DeepEqual(act, test.Expectation) {
+			t.Errorf("%q: expected %v, actual %v", test.Input, test.Expectation, act)
+		}
+	}
+}
+
+func TestUnmarshalPluginPackageType(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation PackageType
+		Config      PackageConfig
+		Error       bool
+	}{
+		{Input: "type: go", Expectation: GoPackage, Config: GoPkgConfig{Packaging: GoApp}},
+		{Input: "type: bazel\nconfig:\n  target: //foo", Expectation: "bazel", Config: PluginPkgConfig{"target": "//foo"}},
+		{Input: "type: bazel", Expectation: "bazel", Config: PluginPkgConfig{}},
+		{Input: "type: Bazel!", Error: true},
+	}
+
+	for _, test := range tests {
+		var pkg struct {
+			Type PackageType `yaml:"type"`
+		}
+		err := yaml.Unmarshal([]byte(test.Input), &pkg)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", test.Input, pkg.Type)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if pkg.Type != test.Expectation {
+			t.Errorf("%q: expected type %v, actual %v", test.Input, test.Expectation, pkg.Type)
+		}
+
+		cfg, err := unmarshalTypeDependentConfig(pkg.Type, func(out interface{}) error {
+			return yaml.Unmarshal([]byte(test.Input), out)
+		})
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, test.Config) {
+			t.Errorf("%q: expected config %v, actual %v", test.Input, test.Config, cfg)
+		}
+	}
+}
+
+func TestValidateOutputs(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Type    PackageType
+		Config  PackageConfig
+		Outputs []string
+		Error   bool
+	}{
+		{Name: "no outputs", Type: DockerPackage, Config: DockerPkgConfig{}},
+		{Name: "generic", Type: GenericPackage, Config: GenericPkgConfig{}, Outputs: []string{"dist/**", "app"}},
+		{Name: "go app", Type: GoPackage, Config: GoPkgConfig{Packaging: GoApp}, Outputs: []string{"app"}},
+		{Name: "go modcache", Type: GoPackage, Config: GoPkgConfig{Packaging: GoModCache}, Outputs: []string{"app"}, Error: true},
+		{Name: "unsupported type", Type: YarnPackage, Config: YarnPkgConfig{}, Outputs: []string{"dist"}, Error: true},
+		{Name: "absolute", Type: GenericPackage, Config: GenericPkgConfig{}, Outputs: []string{"/dist"}, Error: true},
+		{Name: "parent", Type: GenericPackage, Config: GenericPkgConfig{}, Outputs: []string{"../dist"}, Error: true},
+		{Name: "invalid glob", Type: GenericPackage, Config: GenericPkgConfig{}, Outputs: []string{"dist/[a"}, Error: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := validateOutputs(test.Type, test.Config, test.Outputs)
+			if test.Error && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.Error && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatePlugins(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Plugins map[PackageType]*BuilderPlugin
+		Error   bool
+	}{
+		{Name: "no plugins"},
+		{Name: "valid plugin", Plugins: map[PackageType]*BuilderPlugin{"bazel": {Command: []string{"bazel-plugin"}}}},
+		{Name: "missing command", Plugins: map[PackageType]*BuilderPlugin{"bazel": {}}, Error: true},
+		{Name: "builtin type", Plugins: map[PackageType]*BuilderPlugin{GoPackage: {Command: []string{"go-plugin"}}}, Error: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := validatePlugins(test.Plugins)
+			if test.Error && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.Error && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalDockerConfig(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation DockerPkgConfig
+		Error       bool
+	}{
+		{Input: "config: {}", Expectation: DockerPkgConfig{Dockerfile: "Dockerfile", Backend: DockerBackendDocker}},
+		{Input: "config:\n  squash: true", Expectation: DockerPkgConfig{Dockerfile: "Dockerfile", Backend: DockerBackendDocker, Squash: true}},
+		{
+			Input: "config:\n  backend: buildx\n  platforms: [linux/amd64, linux/arm64]\n  secrets:\n  - id: npmrc\n    src: /home/user/.npmrc\n  - id: token\n    env: TOKEN",
+			Expectation: DockerPkgConfig{
+				Dockerfile: "Dockerfile",
+				Backend:    DockerBackendBuildx,
+				Platforms:  []string{"linux/amd64", "linux/arm64"},
+				Secrets: []DockerSecret{
+					{ID: "npmrc", Src: "/home/user/.npmrc"},
+					{ID: "token", Env: "TOKEN"},
+				},
+			},
+		},
+		{Input: "config:\n  backend: kaniko", Error: true},
+		{Input: "config:\n  platforms: [linux/amd64]", Error: true},
+		{Input: "config:\n  backend: buildx\n  squash: true", Error: true},
+		{Input: "config:\n  backend: buildx\n  platforms: [\"linux/amd64,linux/arm64\"]", Error: true},
+		{Input: "config:\n  backend: buildx\n  secrets:\n  - id: token", Error: true},
+		{Input: "config:\n  backend: buildx\n  secrets:\n  - id: token\n    env: A\n  - id: token\n    env: B", Error: true},
+	}
+
+	for _, test := range tests {
+		act, err := unmarshalTypeDependentConfig(DockerPackage, func(out interface{}) error {
+			return yaml.Unmarshal([]byte(test.Input), out)
+		})
+		if test.Error {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", test.Input, act)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if !reflect.DeepEqual(act, test.Expectation) {
+			t.Errorf("%q: expected %v, actual %v", test.Input, test.Expectation, act)
+		}
+	}
+}
+
+func TestUnmarshalWorkspaceDocker(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation DockerBuilder
+		Error       bool
+	}{
+		{Input: "{}", Expectation: ""},
+		{Input: "builder: docker", Expectation: DockerBuilderDocker},
+		{Input: "builder: podman", Expectation: DockerBuilderPodman},
+		{Input: "builder: buildah", Expectation: DockerBuilderBuildah},
+		{Input: "builder: kaniko", Error: true},
+	}
+
+	for _, test := range tests {
+		var act WorkspaceDocker
+		err := yaml.Unmarshal([]byte(test.Input), &act)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", test.Input, act)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if act.Builder != test.Expectation {
+			t.Errorf("%q: expected %v, actual %v", test.Input, test.Expectation, act.Builder)
+		}
+	}
+}
+
+func TestUnmarshalGoConfig(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation GoPkgConfig
+		Error       bool
+	}{
+		{Input: "config: {}", Expectation: GoPkgConfig{Packaging: GoApp}},
+		{Input: "config:\n  goVersion: go1.22.5", Expectation: GoPkgConfig{Packaging: GoApp, GoVersion: "go1.22.5"}},
+		{Input: "config:\n  goVersion: 1.23rc1", Expectation: GoPkgConfig{Packaging: GoApp, GoVersion: "1.23rc1"}},
+		{Input: "config:\n  goVersion: latest", Error: true},
+		{Input: "config:\n  platforms: [linux/amd64, darwin/arm64]", Expectation: GoPkgConfig{Packaging: GoApp, Platforms: []string{"linux/amd64", "darwin/arm64"}}},
+		{Input: "config:\n  platforms: [linux]", Error: true},
+		{Input: "config:\n  platforms: [linux/]", Error: true},
+		{Input: "config:\n  platforms: [/amd64]", Error: true},
+		{Input: "config:\n  platforms: [linux/arm/v7]", Error: true},
+		{Input: "config:\n  platforms: [linux/amd64, linux/amd64]", Error: true},
+		{Input: "config:\n  packaging: library\n  platforms: [linux/amd64]", Error: true},
+		{Input: "config:\n  buildCommand: [make]\n  platforms: [linux/amd64]", Error: true},
+		{Input: "config:\n  packaging: modcache\n  workspaceModules: true", Expectation: GoPkgConfig{Packaging: GoModCache, WorkspaceModules: true}},
+		{Input: "config:\n  packaging: modcache\n  buildCommand: [make]", Error: true},
+		{Input: "config:\n  workspaceModules: true", Error: true},
+		{Input: "config:\n  minCoverage: 80", Expectation: GoPkgConfig{Packaging: GoApp, MinCoverage: 80}},
+		{Input: "config:\n  minCoverage: 101", Error: true},
+		{Input: "config:\n  minCoverage: 80\n  dontTest: true", Error: true},
+	}
+
+	for _, test := range tests {
+		act, err := unmarshalTypeDependentConfig(GoPackage, func(out interface{}) error {
+			return yaml.Unmarshal([]byte(test.Input), out)
+		})
+		if test.Error {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", test.Input, act)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if !reflect.DeepEqual(act, test.Expectation) {
+			t.Errorf("%q: expected %v, actual %v", test.Input, test.Expectation, act)
+		}
+	}
+}
+
+func TestWorkspaceGoModuleFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, fn := range []string{"a/go.mod", "a/go.sum", "b/go.mod", "c/other.mod", "c/other.sum", "modcache/go.mod"} {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(fn)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, fn), []byte("module foo\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	newPkg := func(comp string, tpe PackageType, cfg PackageConfig) *Package {
+		return &Package{
+			C:               &Component{Origin: filepath.Join(dir, comp)},
+			PackageInternal: PackageInternal{Type: tpe},
+			Config:          cfg,
+		}
+	}
+	pkgs := map[string]*Package{
+		"a:lib":           newPkg("a", GoPackage, GoPkgConfig{Packaging: GoLibrary}),
+		"a:app":           newPkg("a", GoPackage, GoPkgConfig{Packaging: GoApp}),
+		"b:app":           newPkg("b", GoPackage, GoPkgConfig{Packaging: GoApp}),
+		"c:app":           newPkg("c", GoPackage, GoPkgConfig{Packaging: GoApp, GoMod: "other.mod"}),
+		"d:generic":       newPkg("d", GenericPackage, GenericPkgConfig{}),
+		"modcache:gomods": newPkg("modcache", GoPackage, GoPkgConfig{Packaging: GoModCache, WorkspaceModules: true}),
+	}
+
+	act := workspaceGoModuleFiles(pkgs)
+	var expectation []string
+	for _, fn := range []string{"a/go.mod", "a/go.sum", "b/go.mod", "c/other.mod", "c/other.sum"} {
+		expectation = append(expectation, filepath.Join(dir, fn))
+	}
+	if !reflect.DeepEqual(act, expectation) {
+		t.Errorf("workspaceGoModuleFiles() = %v, expected %v", act, expectation)
+	}
+}
+
+func TestGoToolchain(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Config      GoPkgConfig
+		GoMod       string
+		Expectation string
+	}{
+		{Name: "goVersion", Config: GoPkgConfig{GoVersion: "1.22.5"}, GoMod: "module foo\n\ngo 1.22\n\ntoolchain go1.23.1\n", Expectation: "go1.22.5"},
+		{Name: "toolchain directive", GoMod: "module foo\n\ngo 1.22\n\ntoolchain go1.23.1\n", Expectation: "go1.23.1"},
+		{Name: "not pinned", GoMod: "module foo\n\ngo 1.22\n", Expectation: ""},
+		{Name: "no go.mod", Expectation: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			if test.GoMod != "" {
+				err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(test.GoMod), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			pkg := &Package{
+				C:               &Component{Origin: dir},
+				PackageInternal: PackageInternal{Type: GoPackage},
+				Config:          test.Config,
+			}
+
+			if act := pkg.GoToolchain(); act != test.Expectation {
+				t.Errorf("GoToolchain() = %q, expected %q", act, test.Expectation)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package turbocache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// BuilderPlugin is an executable which builds packages of a type turbocache does not know itself.
+// turbocache sends the plugin a pluginRequest as JSON on stdin and expects a JSON response on stdout.
+type BuilderPlugin struct {
+	// Command runs the plugin. Relative paths are resolved against the workspace root.
+	Command []string `yaml:"command"`
+
+	// version and environmentManifest are what the plugin reported when the workspace was loaded
+	version             string
+	environmentManifest EnvironmentManifest
+}
+
+// PluginPkgConfig configures a package which is built by a builder plugin. turbocache passes it to the plugin as is.
+type PluginPkgConfig map[string]interface{}
+
+// AdditionalSources returns a list of unresolved sources coming in through this configuration.
+// Plugins report their additional sources when the workspace is loaded, see loadPlugins.
+func (cfg PluginPkgConfig) AdditionalSources(workspaceOrigin string) []string {
+	return []string{}
+}
+
+const (
+	// pluginActionLoad asks a plugin for its version, environment manifest entries and the additional sources of its packages
+	pluginActionLoad = "load"
+	// pluginActionBuild asks a plugin for the commands which build a package
+	pluginActionBuild = "build"
+)
+
+// pluginRequest is what turbocache sends to a builder plugin
+type pluginRequest struct {
+	Action string `json:"action"`
+	// Workspace is the absolute path of the workspace root
+	Workspace string `json:"workspace"`
+	// Packages are the packages of the plugin's type in the workspace. Only set for the load action.
+	Packages []pluginPackage `json:"packages,omitempty"`
+	// Package is the package to build. Only set for the build action.
+	Package *pluginPackage `json:"package,omitempty"`
+	// Dependencies are the transitive dependencies of the package. Only set for the build action.
+	Dependencies []pluginDependency `json:"dependencies,omitempty"`
+	// BuildDir is the directory the package sources were copied to and in which the build commands run. Only set for the build action.
+	BuildDir string `json:"buildDir,omitempty"`
+	// Result is the path of the build artifact, i.e. the tar.gz the package commands must produce. Only set for the build action.
+	Result string `json:"result,omitempty"`
+	// DontTest is true if the build must not run tests. Only set for the build action.
+	DontTest bool `json:"dontTest,omitempty"`
+}
+
+// pluginPackage describes a package to a builder plugin
+type pluginPackage struct {
+	Name      string          `json:"name"`
+	Component string          `json:"component"`
+	Origin    string          `json:"origin"`
+	Version   string          `json:"version,omitempty"`
+	Sources   []string        `json:"sources"`
+	Config    PluginPkgConfig `json:"config"`
+}
+
+// pluginDependency describes a dependency of the package a builder plugin builds
+type pluginDependency struct {
+	Name    string      `json:"name"`
+	Type    PackageType `json:"type"`
+	Version string      `json:"version"`
+	// Location is the path of the dependency's build artifact
+	Location string `json:"location"`
+	// BuildLayout is where the package expects the dependency in its build directory, see the layout field of packages
+	BuildLayout string `json:"buildLayout"`
+}
+
+// pluginLoadResponse is what a builder plugin answers to the load action
+type pluginLoadResponse struct {
+	// Version is the version of the build process. Changing it changes the version of all packages the plugin builds.
+	Version string `json:"version"`
+	// EnvironmentManifest entries are added to the environment manifest of the workspace
+	EnvironmentManifest []struct {
+		Name    string   `json:"name"`
+		Command []string `json:"command"`
+	} `json:"environmentManifest,omitempty"`
+	// AdditionalSources maps package names to sources which are not listed in the package's srcs.
+	// Relative paths are resolved against the component.
+	AdditionalSources map[string][]string `json:"additionalSources,omitempty"`
+}
+
+// pluginBuildResponse is what a builder plugin answers to the build action
+type pluginBuildResponse struct {
+	Commands map[PackageBuildPhase][][]string `json:"commands"`
+}
+
+// validatePlugins ensures the builder plugins of a workspace can be used
+func validatePlugins(plugins map[PackageType]*BuilderPlugin) error {
+	for tpe, pl := range plugins {
+		if isBuiltinPackageType(tpe) {
+			return xerrors.Errorf("plugin %s: cannot replace the builtin package type", tpe)
+		}
+		if pl == nil || len(pl.Command) == 0 {
+			return xerrors.Errorf("plugin %s: command is required", tpe)
+		}
+	}
+	return nil
+}
+
+// call runs the plugin, sends it req and decodes its response into resp
+func (pl *BuilderPlugin) call(workspaceOrigin, dir string, req pluginRequest, resp interface{}, stderr io.Writer) error {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	name := pl.Command[0]
+	if strings.Contains(name, "/") && !filepath.IsAbs(name) {
+		name = filepath.Join(workspaceOrigin, name)
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(name, pl.Command[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	if err != nil {
+		return xerrors.Errorf("plugin failed on %s: %w", req.Action, err)
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), resp)
+	if err != nil {
+		return xerrors.Errorf("plugin returned an invalid %s response: %w", req.Action, err)
+	}
+	return nil
+}
+
+// loadPlugins asks the plugins of all used package types for their version, environment manifest entries and additional sources.
+// The additional sources are added to the package sources.
+func loadPlugins(workspace *Workspace, pkgtpes map[PackageType]struct{}) error {
+	for tpe := range pkgtpes {
+		pl, ok := workspace.Plugins[tpe]
+		if !ok {
+			continue
+		}
+
+		var (
+			req  = pluginRequest{Action: pluginActionLoad, Workspace: workspace.Origin}
+			pkgs = make(map[string]*Package)
+		)
+		for _, pkg := range workspace.Packages {
+			if pkg.Type != tpe {
+				continue
+			}
+			pkgs[pkg.FullName()] = pkg
+			req.Packages = append(req.Packages, newPluginPackage(pkg, ""))
+		}
+		sort.Slice(req.Packages, func(i, j int) bool { return req.Packages[i].Name < req.Packages[j].Name })
+
+		var resp pluginLoadResponse
+		err := pl.call(workspace.Origin, workspace.Origin, req, &resp, os.Stderr)
+		if err != nil {
+			return xerrors.Errorf("plugin %s: %w", tpe, err)
+		}
+		log.WithField("plugin", tpe).WithField("response", resp).Debug("loaded builder plugin")
+
+		pl.version = resp.Version
+		pl.environmentManifest = nil
+		for _, e := range resp.EnvironmentManifest {
+			if e.Name == "" || len(e.Command) == 0 {
+				return xerrors.Errorf("plugin %s: environment manifest entries need a name and command", tpe)
+			}
+			pl.environmentManifest = append(pl.environmentManifest, EnvironmentManifestEntry{Name: e.Name, Command: e.Command})
+		}
+
+		for name, srcs := range resp.AdditionalSources {
+			pkg, ok := pkgs[name]
+			if !ok {
+				return xerrors.Errorf("plugin %s: reported additional sources for unknown package %s", tpe, name)
+			}
+			err = pkg.addSources(srcs)
+			if err != nil {
+				return xerrors.Errorf("plugin %s: %w", tpe, err)
+			}
+		}
+	}
+	return nil
+}
+
+// addSources adds files to the package sources. Relative paths are resolved against the component.
+func (p *Package) addSources(srcs []string) error {
+	idx := make(map[string]struct{}, len(p.Sources))
+	for _, src := range p.Sources {
+		idx[src] = struct{}{}
+	}
+	for _, src := range srcs {
+		fn := src
+		if !filepath.IsAbs(fn) {
+			fn = filepath.Join(p.C.Origin, fn)
+		}
+		if _, err := os.Stat(fn); err != nil {
+			return xerrors.Errorf("cannot find additional source for %s: %w", p.FullName(), err)
+		}
+		if _, exists := idx[fn]; exists {
+			continue
+		}
+		idx[fn] = struct{}{}
+		p.Sources = append(p.Sources, fn)
+	}
+	return nil
+}
+
+func newPluginPackage(p *Package, version string) pluginPackage {
+	cfg, _ := p.Config.(PluginPkgConfig)
+	if cfg == nil {
+		cfg = PluginPkgConfig{}
+	}
+	srcs := make([]string, len(p.Sources))
+	copy(srcs, p.Sources)
+	sort.Strings(srcs)
+	return pluginPackage{
+		Name:      p.FullName(),
+		Component: p.C.Name,
+		Origin:    p.C.Origin,
+		Version:   version,
+		Sources:   srcs,
+		Config:    cfg,
+	}
+}
+
+// buildPlugin implements the build process for packages whose type is provided by a builder plugin
+func (p *Package) buildPlugin(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	pl, ok := p.C.W.Plugins[p.Type]
+	if !ok {
+		return nil, xerrors.Errorf("cannot build package type: %s", p.Type)
+	}
+
+	version, err := p.Version()
+	if err != nil {
+		return nil, err
+	}
+	pkg := newPluginPackage(p, version)
+	req := pluginRequest{
+		Action:    pluginActionBuild,
+		Workspace: p.C.W.Origin,
+		Package:   &pkg,
+		BuildDir:  wd,
+		Result:    result,
+		DontTest:  buildctx.DontTest,
+	}
+	for _, dep := range p.GetTransitiveDependencies() {
+		if dep.Ephemeral {
+			continue
+		}
+		loc, exists := buildctx.LocalCache.Location(dep)
+		if !exists {
+			return nil, PkgNotBuiltErr{dep}
+		}
+		depVersion, err := dep.Version()
+		if err != nil {
+			return nil, err
+		}
+		req.Dependencies = append(req.Dependencies, pluginDependency{
+			Name:        dep.FullName(),
+			Type:        dep.Type,
+			Version:     depVersion,
+			Location:    loc,
+			BuildLayout: p.BuildLayoutLocation(dep),
+		})
+	}
+
+	var resp pluginBuildResponse
+	err = pl.call(p.C.W.Origin, wd, req, &resp, &reporterStream{R: buildctx.Reporter, P: p, IsErr: true})
+	if err != nil {
+		return nil, xerrors.Errorf("plugin %s: %w", p.Type, err)
+	}
+	for phase, cmds := range resp.Commands {
+		switch phase {
+		case PackageBuildPhasePrep, PackageBuildPhasePull, PackageBuildPhaseLint, PackageBuildPhaseTest, PackageBuildPhaseBuild, PackageBuildPhasePackage:
+		default:
+			return nil, xerrors.Errorf("plugin %s: unknown build phase %s", p.Type, phase)
+		}
+		for _, cmd := range cmds {
+			if len(cmd) == 0 {
+				return nil, xerrors.Errorf("plugin %s: empty command in %s phase", p.Type, phase)
+			}
+		}
+	}
+	if len(resp.Commands[PackageBuildPhasePackage]) == 0 {
+		return nil, xerrors.Errorf("plugin %s: no package commands - the package phase must produce %s", p.Type, result)
+	}
+	if buildctx.DontTest {
+		delete(resp.Commands, PackageBuildPhaseTest)
+	}
+
+	return &packageBuild{
+		Commands: resp.Commands,
+	}, nil
+}
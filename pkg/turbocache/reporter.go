@@ -59,6 +59,12 @@ type PackageBuildReport struct {
 	TestCoveragePercentage int
 	FunctionsWithoutTest   int
 	FunctionsWithTest      int
+
+	// ResourceUsageAvailable is true if the package was built in its own cgroup.
+	// PeakMemoryBytes is zero if the memory controller was not available.
+	ResourceUsageAvailable bool
+	PeakMemoryBytes        uint64
+	CPUTime                time.Duration
 }
 
 // PhaseDuration returns the time it took to execute the phases commands
@@ -219,7 +225,11 @@ func (r *ConsoleReporter) PackageBuildFinished(pkg *Package, rep *PackageBuildRe
 	if rep.TestCoverageAvailable {
 		coverage = color.Sprintf("<fg=yellow>test coverage: %d%%</> <gray>(%d of %d functions have tests)</>\n", rep.TestCoveragePercentage, rep.FunctionsWithTest, rep.FunctionsWithTest+rep.FunctionsWithoutTest)
 	}
-	msg := color.Sprintf("%s<green>package build succeded</> <gray>(%.2fs)</>\n", coverage, dur.Seconds())
+	var usage string
+	if rep.ResourceUsageAvailable {
+		usage = color.Sprintf("<gray>peak memory: %s, CPU time: %.2fs</>\n", formatMemory(rep.PeakMemoryBytes), rep.CPUTime.Seconds())
+	}
+	msg := color.Sprintf("%s%s<green>package build succeded</> <gray>(%.2fs)</>\n", coverage, usage, dur.Seconds())
 	if rep.Error != nil {
 		msg = color.Sprintf("<red>package build failed while %sing</>\n<white>Reason:</> %s\n", rep.LastPhase(), rep.Error)
 	}
@@ -285,6 +295,10 @@ type HTMLPackageReport struct {
 	status   PackageBuildStatus
 	results  []string
 	err      error
+
+	resourceUsageAvailable bool
+	peakMemory             uint64
+	cpuTime                time.Duration
 }
 
 func (r *HTMLPackageReport) StatusIcon() string {
@@ -311,6 +325,20 @@ func (r *HTMLPackageReport) DurationInSeconds() string {
 	return fmt.Sprintf("%.2fs", r.duration.Seconds())
 }
 
+func (r *HTMLPackageReport) PeakMemory() string {
+	if !r.resourceUsageAvailable || r.peakMemory == 0 {
+		return "-"
+	}
+	return formatMemory(r.peakMemory)
+}
+
+func (r *HTMLPackageReport) CPUTimeInSeconds() string {
+	if !r.resourceUsageAvailable {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fs", r.cpuTime.Seconds())
+}
+
 func (r *HTMLPackageReport) HasLogs() bool {
 	return r.logs.Len() > 0
 }
@@ -399,6 +427,9 @@ func (r *HTMLReporter) PackageBuildFinished(pkg *Package, rep *PackageBuildRepor
 	hrep.duration = time.Since(hrep.start)
 	hrep.status = PackageBuilt
 	hrep.err = rep.Error
+	hrep.resourceUsageAvailable = rep.ResourceUsageAvailable
+	hrep.peakMemory = rep.PeakMemoryBytes
+	hrep.cpuTime = rep.CPUTime
 
 	if cfg, ok := pkg.Config.(DockerPkgConfig); ok && pkg.Type == DockerPackage {
 		hrep.results = cfg.Image
@@ -420,6 +451,8 @@ func (r *HTMLReporter) Report() {
 			<td>🚦 Status</td>
 			<td>📦 Package</td>
 			<td>⏰ Duration</td>
+			<td>🧠 Peak Memory</td>
+			<td>⚙️ CPU Time</td>
 			<td>🔬 Details</td>
 		</tr>
 	</thread>
@@ -429,6 +462,8 @@ func (r *HTMLReporter) Report() {
 			<td>{{ $report.StatusIcon }}</td>
 			<td>{{ $pkg }}</td>
 			<td>{{ $report.DurationInSeconds -}}</td>
+			<td>{{ $report.PeakMemory -}}</td>
+			<td>{{ $report.CPUTimeInSeconds -}}</td>
 			<td><a href="#{{ $report.ID }}">See below</td>
 		</tr>
 		{{- end }}
@@ -589,6 +624,12 @@ func (sr *SegmentReporter) PackageBuildFinished(pkg *Package, rep *PackageBuildR
 		props["functionsWithoutTest"] = rep.FunctionsWithoutTest
 		props["functionsWithTest"] = rep.FunctionsWithTest
 	}
+	if rep.ResourceUsageAvailable {
+		props["cpuTimeMS"] = rep.CPUTime.Milliseconds()
+		if rep.PeakMemoryBytes > 0 {
+			props["peakMemoryBytes"] = rep.PeakMemoryBytes
+		}
+	}
 	addPackageToSegmentEventProps(props, pkg)
 	sr.track("package_build_finished", props)
 }
@@ -657,3 +698,21 @@ func (sr *GitHubActionReporter) PackageBuildFinished(pkg *Package, rep *PackageB
 	}
 	fmt.Fprintf(f, "%s=%v\n", pkg.FilesystemSafeName(), success)
 }
+
+// formatMemory renders an amount of memory in bytes in human readable form.
+// Zero bytes means the amount is unknown, e.g. because the memory controller is not available.
+func formatMemory(bytes uint64) string {
+	const unit = 1024
+	if bytes == 0 {
+		return "unknown"
+	}
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,257 @@
+package turbocache
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// sandboxSpec describes the commands run in a sandbox and the environment they run in
+type sandboxSpec struct {
+	Commands [][]string `json:"commands"`
+	Env      []string   `json:"env"`
+	Workdir  string     `json:"workdir"`
+	// Writable lists the paths which remain writable in the sandbox. Everything else is mounted read-only.
+	Writable  []string         `json:"writable"`
+	Isolation sandboxIsolation `json:"isolation"`
+}
+
+// executeCommandsForPackageSandboxed runs the commands in a sandbox built from Linux namespaces.
+// We re-execute ourselves ("plumbing sandbox") within those namespaces which then sets up the filesystem
+// and network (see RunSandbox).
+func executeCommandsForPackageSandboxed(buildctx *buildContext, p *Package, wd string, commands [][]string, isolation sandboxIsolation, cg *packageCgroup) error {
+	tmpdir, err := os.MkdirTemp("", "turbocache-sandbox-*")
+	if err != nil {
+		return err
+	}
+	if !log.IsLevelEnabled(log.DebugLevel) {
+		defer os.RemoveAll(tmpdir)
+	}
+
+	writable := []string{buildctx.BuildDir()}
+	if result, _ := buildctx.LocalCache.Location(p); result != "" {
+		writable = append(writable, filepath.Dir(result))
+	}
+	if buildctx.CoverageOutputPath != "" {
+		writable = append(writable, buildctx.CoverageOutputPath)
+	}
+	if p.Type == GoPackage {
+		caches := p.C.W.GoCaches()
+		writable = append(writable, caches.Build, caches.Module)
+	}
+	for i, w := range writable {
+		w, err = filepath.Abs(w)
+		if err != nil {
+			return err
+		}
+		writable[i] = w
+	}
+
+	spec := sandboxSpec{
+		Commands:  commands,
+		Env:       p.buildEnvironment(wd),
+		Workdir:   wd,
+		Writable:  writable,
+		Isolation: isolation,
+	}
+	fc, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	specFN := filepath.Join(tmpdir, "spec.json")
+	err = os.WriteFile(specFN, fc, 0644)
+	if err != nil {
+		return err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{"plumbing", "sandbox", specFN}
+	if log.IsLevelEnabled(log.DebugLevel) {
+		args = append(args, "--verbose")
+	}
+
+	cloneflags := uintptr(syscall.CLONE_NEWUSER)
+	if isolation.Filesystem {
+		cloneflags |= syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	}
+	if isolation.Network {
+		cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	log.WithField("package", p.FullName()).WithField("spec", specFN).Debug("running commands in sandbox")
+	cmd := exec.Command(self, args...)
+	cmd.Dir = wd
+	cmd.Stdout = &reporterStream{R: buildctx.Reporter, P: p, IsErr: false}
+	cmd.Stderr = &reporterStream{R: buildctx.Reporter, P: p, IsErr: true}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 cloneflags,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	cg.Apply(cmd)
+	return cmd.Run()
+}
+
+// RunSandbox sets up the sandbox filesystem and network, and runs the commands of the sandbox spec.
+// This function expects to run in the namespaces created by executeCommandsForPackageSandboxed, and must not be called otherwise.
+func RunSandbox(specFN string) error {
+	fc, err := os.ReadFile(specFN)
+	if err != nil {
+		return err
+	}
+	var spec sandboxSpec
+	err = json.Unmarshal(fc, &spec)
+	if err != nil {
+		return xerrors.Errorf("cannot unmarshal sandbox spec: %w", err)
+	}
+
+	if spec.Isolation.Filesystem {
+		err = setupSandboxFilesystem(spec.Writable)
+		if err != nil {
+			return xerrors.Errorf("cannot set up sandbox filesystem: %w", err)
+		}
+	}
+	if spec.Isolation.Network {
+		// the loopback device of a new network namespace is down
+		err = setLinkUp("lo")
+		if err != nil {
+			return xerrors.Errorf("cannot set up sandbox network: %w", err)
+		}
+	}
+
+	for _, c := range spec.Commands {
+		log.WithField("command", strings.Join(c, " ")).Debug("running")
+
+		cmd := exec.Command(c[0], c[1:]...)
+		cmd.Dir = spec.Workdir
+		cmd.Env = spec.Env
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return xerrors.Errorf("%s: %w", strings.Join(c, " "), err)
+		}
+	}
+	return nil
+}
+
+// setupSandboxFilesystem makes the whole filesystem read-only with the exception of the writable paths,
+// and mounts a private /tmp.
+func setupSandboxFilesystem(writable []string) error {
+	err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+	if err != nil {
+		return xerrors.Errorf("cannot make mounts private: %w", err)
+	}
+
+	// Writable paths may well live in /tmp which we're about to hide behind a tmpfs.
+	// Hence we clone their mount trees before making everything read-only, and move them back in place later.
+	writable = topmostPaths(writable)
+	trees := make([]int, len(writable))
+	for i, w := range writable {
+		err = os.MkdirAll(w, 0755)
+		if err != nil {
+			return err
+		}
+		trees[i], err = unix.OpenTree(unix.AT_FDCWD, w, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC|unix.AT_RECURSIVE)
+		if err != nil {
+			return xerrors.Errorf("cannot clone %s: %w", w, err)
+		}
+	}
+
+	err = unix.MountSetattr(unix.AT_FDCWD, "/", unix.AT_RECURSIVE, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY})
+	if err != nil {
+		return xerrors.Errorf("cannot make filesystem read-only: %w", err)
+	}
+
+	for _, tmp := range []string{"/tmp", "/dev/shm"} {
+		if _, err := os.Stat(tmp); err != nil {
+			continue
+		}
+		err = unix.Mount("tmpfs", tmp, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777")
+		if err != nil {
+			return xerrors.Errorf("cannot mount %s: %w", tmp, err)
+		}
+	}
+
+	for i, w := range writable {
+		err = os.MkdirAll(w, 0755)
+		if err != nil {
+			return err
+		}
+		err = unix.MoveMount(trees[i], "", unix.AT_FDCWD, w, unix.MOVE_MOUNT_F_EMPTY_PATH)
+		if err != nil {
+			return xerrors.Errorf("cannot mount %s: %w", w, err)
+		}
+		unix.Close(trees[i])
+	}
+
+	// We're in a new PID namespace, hence need a new procfs to match. Some container runtimes
+	// mask parts of /proc which makes this fail. In that case we keep the original one.
+	err = unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+	if err != nil {
+		log.WithError(err).Debug("cannot mount /proc in sandbox - using the host's")
+	}
+
+	return nil
+}
+
+// topmostPaths removes duplicates and all paths which are contained in another path of the list
+func topmostPaths(paths []string) []string {
+	sorted := make([]string, len(paths))
+	copy(sorted, paths)
+	sort.Strings(sorted)
+
+	var res []string
+	for _, p := range sorted {
+		p = filepath.Clean(p)
+
+		var contained bool
+		for _, r := range res {
+			if p == r || strings.HasPrefix(p, r+string(os.PathSeparator)) {
+				contained = true
+				break
+			}
+		}
+		if contained {
+			continue
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+func setLinkUp(name string) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr)
+	if err != nil {
+		return xerrors.Errorf("cannot get flags of %s: %w", name, err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	err = unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+	if err != nil {
+		return xerrors.Errorf("cannot set %s up: %w", name, err)
+	}
+	return nil
+}
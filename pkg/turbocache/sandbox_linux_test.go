@@ -0,0 +1,38 @@
+package turbocache
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTopmostPaths(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Input       []string
+		Expectation []string
+	}{
+		{
+			Name: "empty",
+		},
+		{
+			Name:        "duplicates",
+			Input:       []string{"/tmp/build", "/tmp/build/"},
+			Expectation: []string{"/tmp/build"},
+		},
+		{
+			Name:        "nested",
+			Input:       []string{"/tmp/build/cache", "/tmp/build-cache", "/tmp/build"},
+			Expectation: []string{"/tmp/build", "/tmp/build-cache"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := topmostPaths(test.Input)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("topmostPaths() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
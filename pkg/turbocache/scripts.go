@@ -58,7 +58,7 @@ func (p *Script) link(idx map[string]*Package) error {
 	p.dependencies = make([]*Package, len(p.Dependencies))
 	for i, dep := range p.Dependencies {
 		var ok bool
-		p.dependencies[i], ok = idx[dep]
+		p.dependencies[i], ok = lookupPackage(idx, dep)
 		if !ok {
 			return PackageNotFoundErr{dep}
 		}
@@ -29,6 +29,21 @@ func WatchSources(ctx context.Context, pkgs []*Package, debounceDuration time.Du
 		return
 	}
 
+	// named outputs change whenever the package they belong to changes
+	pkgs = append([]*Package{}, pkgs...)
+	seen := make(map[*Package]struct{}, len(pkgs))
+	for i := 0; i < len(pkgs); i++ {
+		pkg := pkgs[i]
+		if _, ok := seen[pkg]; ok {
+			continue
+		}
+		seen[pkg] = struct{}{}
+		if pkg.outputOf != nil {
+			pkgs = append(pkgs, pkg.outputOf)
+			pkgs = append(pkgs, pkg.outputOf.GetTransitiveDependencies()...)
+		}
+	}
+
 	var (
 		matcher []*pathMatcher
 		folders = make(map[string]*Package)
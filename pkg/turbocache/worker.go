@@ -0,0 +1,721 @@
+package turbocache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// workerJobFile is the name of the job description in a job bundle
+	workerJobFile = "job.json"
+
+	// workerWorkspaceDir is the directory in a job bundle which contains the (partial) workspace
+	workerWorkspaceDir = "workspace"
+
+	// workerCacheDir is the directory in a job bundle which contains the dependency build artifacts
+	workerCacheDir = "cache"
+
+	// workerJobExpiry is the time after which a worker removes a job whose artifact was never downloaded
+	workerJobExpiry = 30 * time.Minute
+)
+
+// workerJob describes a single package build a coordinator dispatches to a worker
+type workerJob struct {
+	// Package is the full name of the package to build
+	Package string `json:"package"`
+	// Version is the version the coordinator computed for the package. The worker must arrive at the same version.
+	Version string `json:"version"`
+	// Packages lists all packages contained in the job bundle, i.e. the package and its transitive dependencies
+	Packages []string `json:"packages"`
+	// PackageTypes lists all package types used in the coordinator's workspace, which determine the environment manifest
+	PackageTypes []PackageType `json:"packageTypes"`
+	// JSPackageManagers lists all package managers used by yarn packages in the coordinator's workspace
+	JSPackageManagers []JSPackageManager `json:"jsPackageManagers,omitempty"`
+	// Environment is the coordinator's environment manifest
+	Environment map[string]string `json:"environment"`
+	Args        Arguments         `json:"args,omitempty"`
+	Variant     string            `json:"variant,omitempty"`
+
+	DontTest           bool `json:"dontTest,omitempty"`
+	DontCompress       bool `json:"dontCompress,omitempty"`
+	JailedExecution    bool `json:"jailedExecution,omitempty"`
+	SandboxedExecution bool `json:"sandboxedExecution,omitempty"`
+}
+
+// workerEvent is streamed from the worker to the coordinator while a job runs
+type workerEvent struct {
+	Log    *workerLog       `json:"log,omitempty"`
+	Result *workerJobResult `json:"result,omitempty"`
+}
+
+type workerLog struct {
+	IsErr bool   `json:"isErr,omitempty"`
+	Data  []byte `json:"data"`
+}
+
+// workerJobResult is the final event of a job
+type workerJobResult struct {
+	JobID string `json:"jobID"`
+	Error string `json:"error,omitempty"`
+	// Artifact is the filename of the build artifact, e.g. <version>.tar.gz
+	Artifact string `json:"artifact,omitempty"`
+
+	Phases                 []PackageBuildPhase             `json:"phases,omitempty"`
+	PhaseEnter             map[PackageBuildPhase]time.Time `json:"phaseEnter,omitempty"`
+	PhaseDone              map[PackageBuildPhase]time.Time `json:"phaseDone,omitempty"`
+	TestCoverageAvailable  bool                            `json:"testCoverageAvailable,omitempty"`
+	TestCoveragePercentage int                             `json:"testCoveragePercentage,omitempty"`
+	FunctionsWithoutTest   int                             `json:"functionsWithoutTest,omitempty"`
+	FunctionsWithTest      int                             `json:"functionsWithTest,omitempty"`
+	ResourceUsageAvailable bool                            `json:"resourceUsageAvailable,omitempty"`
+	PeakMemoryBytes        uint64                          `json:"peakMemoryBytes,omitempty"`
+	CPUTime                time.Duration                   `json:"cpuTime,omitempty"`
+}
+
+// workerInfo is served by workers to let coordinators know what they're dealing with
+type workerInfo struct {
+	Version  string `json:"version"`
+	Capacity int    `json:"capacity"`
+}
+
+// Worker executes package builds dispatched by a coordinator (see WithWorkers)
+type Worker struct {
+	workdir  string
+	capacity int
+	slots    chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]string
+}
+
+// NewWorker creates a new worker which runs up to capacity package builds at once in the workdir
+func NewWorker(workdir string, capacity int) (*Worker, error) {
+	if capacity < 1 {
+		return nil, xerrors.Errorf("worker capacity must be >= 1")
+	}
+	workdir, err := filepath.Abs(workdir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(workdir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Worker{
+		workdir:  workdir,
+		capacity: capacity,
+		slots:    make(chan struct{}, capacity),
+		jobs:     make(map[string]string),
+	}, nil
+}
+
+// Handler returns the HTTP handler coordinators talk to
+func (w *Worker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/info", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		//nolint:errcheck
+		json.NewEncoder(rw).Encode(workerInfo{Version: Version, Capacity: w.capacity})
+	})
+	mux.HandleFunc("POST /v1/jobs", w.handleJob)
+	mux.HandleFunc("GET /v1/jobs/{id}/artifact", w.handleArtifact)
+	return mux
+}
+
+func (w *Worker) handleJob(rw http.ResponseWriter, req *http.Request) {
+	select {
+	case w.slots <- struct{}{}:
+		defer func() { <-w.slots }()
+	default:
+		http.Error(rw, "worker is at capacity", http.StatusServiceUnavailable)
+		return
+	}
+
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := hex.EncodeToString(b)
+	jobdir := filepath.Join(w.workdir, id)
+
+	err = extractWorkerBundle(req.Body, jobdir)
+	if err != nil {
+		os.RemoveAll(jobdir)
+		http.Error(rw, fmt.Sprintf("cannot extract job bundle: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.WriteHeader(http.StatusOK)
+	rep := &workerReporter{out: json.NewEncoder(rw)}
+	if f, ok := rw.(http.Flusher); ok {
+		rep.flush = f.Flush
+	}
+
+	res := w.runJob(jobdir, rep)
+	res.JobID = id
+	if res.Error != "" {
+		os.RemoveAll(jobdir)
+	} else {
+		w.mu.Lock()
+		w.jobs[id] = jobdir
+		w.mu.Unlock()
+		time.AfterFunc(workerJobExpiry, func() { w.removeJob(id) })
+	}
+	rep.send(workerEvent{Result: res})
+}
+
+// runJob builds the package of the job bundle extracted to jobdir
+func (w *Worker) runJob(jobdir string, rep *workerReporter) *workerJobResult {
+	fc, err := os.ReadFile(filepath.Join(jobdir, workerJobFile))
+	if err != nil {
+		return &workerJobResult{Error: err.Error()}
+	}
+	var job workerJob
+	err = json.Unmarshal(fc, &job)
+	if err != nil {
+		return &workerJobResult{Error: fmt.Sprintf("cannot unmarshal job: %v", err)}
+	}
+	log.WithField("package", job.Package).WithField("version", job.Version).Info("building package")
+
+	ws, err := loadWorkspace(context.Background(), filepath.Join(jobdir, workerWorkspaceDir), job.Args, job.Variant, &loadWorkspaceOpts{
+		Packages:          job.Packages,
+		PackageTypes:      job.PackageTypes,
+		JSPackageManagers: job.JSPackageManagers,
+	})
+	if err != nil {
+		return &workerJobResult{Error: fmt.Sprintf("cannot load workspace: %v", err)}
+	}
+	pkg, ok := ws.Packages[job.Package]
+	if !ok {
+		return &workerJobResult{Error: PackageNotFoundErr{job.Package}.Error()}
+	}
+	version, err := pkg.Version()
+	if err != nil {
+		return &workerJobResult{Error: err.Error()}
+	}
+	if version != job.Version {
+		msg := fmt.Sprintf("worker computed version %s for %s, but the coordinator expected %s", version, job.Package, job.Version)
+		if diff := diffEnvironmentManifest(job.Environment, ws.EnvironmentManifest); len(diff) > 0 {
+			msg += " - the worker's environment differs: " + strings.Join(diff, ", ")
+		}
+		return &workerJobResult{Error: msg}
+	}
+
+	cache, err := NewFilesystemCache(filepath.Join(jobdir, workerCacheDir))
+	if err != nil {
+		return &workerJobResult{Error: err.Error()}
+	}
+	rep.pkg = pkg
+	err = Build(pkg,
+		WithLocalCache(cache),
+		WithReporter(rep),
+		WithDontTest(job.DontTest),
+		WithCompressionDisabled(job.DontCompress),
+		WithJailedExecution(job.JailedExecution),
+		WithSandboxedExecution(job.SandboxedExecution),
+	)
+
+	res := &workerJobResult{}
+	if prep := rep.report; prep != nil {
+		res.Phases = prep.Phases
+		res.PhaseEnter = prep.phaseEnter
+		res.PhaseDone = prep.phaseDone
+		res.TestCoverageAvailable = prep.TestCoverageAvailable
+		res.TestCoveragePercentage = prep.TestCoveragePercentage
+		res.FunctionsWithoutTest = prep.FunctionsWithoutTest
+		res.FunctionsWithTest = prep.FunctionsWithTest
+		res.ResourceUsageAvailable = prep.ResourceUsageAvailable
+		res.PeakMemoryBytes = prep.PeakMemoryBytes
+		res.CPUTime = prep.CPUTime
+		if prep.Error != nil {
+			// the package build error is more telling than the generic one Build returns
+			err = prep.Error
+		}
+	}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	artifact, exists := cache.Location(pkg)
+	if !exists {
+		res.Error = "build did not produce an artifact"
+		return res
+	}
+	res.Artifact = filepath.Base(artifact)
+	return res
+}
+
+func (w *Worker) handleArtifact(rw http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	w.mu.Lock()
+	jobdir, ok := w.jobs[id]
+	w.mu.Unlock()
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+
+	artifacts, err := filepath.Glob(filepath.Join(jobdir, workerCacheDir, "*.tar*"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := req.URL.Query().Get("name")
+	for _, fn := range artifacts {
+		if filepath.Base(fn) != name {
+			continue
+		}
+
+		http.ServeFile(rw, req, fn)
+		w.removeJob(id)
+		return
+	}
+	http.NotFound(rw, req)
+}
+
+func (w *Worker) removeJob(id string) {
+	w.mu.Lock()
+	jobdir, ok := w.jobs[id]
+	delete(w.jobs, id)
+	w.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	err := os.RemoveAll(jobdir)
+	if err != nil {
+		log.WithError(err).WithField("job", id).Warn("cannot remove job")
+	}
+}
+
+// diffEnvironmentManifest lists the environment manifest entries whose value differs from the expected one
+func diffEnvironmentManifest(expected map[string]string, actual EnvironmentManifest) []string {
+	var res []string
+	for _, e := range actual {
+		exp, ok := expected[e.Name]
+		if !ok || exp == e.Value {
+			continue
+		}
+		res = append(res, fmt.Sprintf("%s is %q instead of %q", e.Name, e.Value, exp))
+	}
+	return res
+}
+
+// workerReporter streams the log output of a package build to the coordinator
+type workerReporter struct {
+	NoopReporter
+
+	pkg    *Package
+	report *PackageBuildReport
+
+	mu    sync.Mutex
+	out   *json.Encoder
+	flush func()
+}
+
+func (r *workerReporter) send(evt workerEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.out.Encode(evt)
+	if err != nil {
+		log.WithError(err).Warn("cannot send event to coordinator")
+		return
+	}
+	if r.flush != nil {
+		r.flush()
+	}
+}
+
+func (r *workerReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	data := make([]byte, len(buf))
+	copy(data, buf)
+	r.send(workerEvent{Log: &workerLog{IsErr: isErr, Data: data}})
+}
+
+func (r *workerReporter) PackageBuildFinished(pkg *Package, rep *PackageBuildReport) {
+	if pkg == r.pkg {
+		r.report = rep
+	}
+}
+
+// WorkerPool dispatches package builds to workers (see turbocache worker)
+type WorkerPool struct {
+	slots  chan string
+	client *http.Client
+}
+
+// NewWorkerPool registers the workers listening at the given addresses, e.g. http://localhost:7080
+func NewWorkerPool(addrs []string) (*WorkerPool, error) {
+	client := &http.Client{}
+
+	var slots []string
+	for _, addr := range addrs {
+		addr = strings.TrimSuffix(addr, "/")
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+
+		resp, err := client.Get(addr + "/v1/info")
+		if err != nil {
+			return nil, xerrors.Errorf("cannot reach worker %s: %w", addr, err)
+		}
+		var info workerInfo
+		err = json.NewDecoder(resp.Body).Decode(&info)
+		resp.Body.Close()
+		if err != nil {
+			return nil, xerrors.Errorf("cannot get info of worker %s: %w", addr, err)
+		}
+		if info.Version != Version {
+			log.WithField("worker", addr).WithField("workerVersion", info.Version).Warn("worker runs a different turbocache version")
+		}
+		log.WithField("worker", addr).WithField("capacity", info.Capacity).Debug("registered worker")
+
+		for i := 0; i < info.Capacity; i++ {
+			slots = append(slots, addr)
+		}
+	}
+	if len(slots) == 0 {
+		return nil, xerrors.Errorf("no worker capacity available")
+	}
+
+	res := &WorkerPool{
+		slots:  make(chan string, len(slots)),
+		client: client,
+	}
+	for _, s := range slots {
+		res.slots <- s
+	}
+	return res, nil
+}
+
+// build builds the package on the next free worker and places the build artifact in the local cache.
+// All dependencies of the package must have been built already.
+func (wp *WorkerPool) build(buildctx *buildContext, p *Package, rep *PackageBuildReport) error {
+	job, err := newWorkerJob(buildctx, p)
+	if err != nil {
+		return err
+	}
+
+	worker := <-wp.slots
+	defer func() { wp.slots <- worker }()
+	log.WithField("package", p.FullName()).WithField("worker", worker).Debug("dispatching package build")
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeWorkerBundle(pw, buildctx, p, job))
+	}()
+	resp, err := wp.client.Post(worker+"/v1/jobs", "application/gzip", pr)
+	if err != nil {
+		return xerrors.Errorf("cannot dispatch %s to worker %s: %w", p.FullName(), worker, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return xerrors.Errorf("worker %s rejected %s: %s", worker, p.FullName(), strings.TrimSpace(string(msg)))
+	}
+
+	var res *workerJobResult
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var evt workerEvent
+		err = dec.Decode(&evt)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return xerrors.Errorf("lost connection to worker %s: %w", worker, err)
+		}
+		if evt.Log != nil {
+			buildctx.Reporter.PackageBuildLog(p, evt.Log.IsErr, evt.Log.Data)
+		}
+		if evt.Result != nil {
+			res = evt.Result
+		}
+	}
+	if res == nil {
+		return xerrors.Errorf("worker %s did not report a result for %s", worker, p.FullName())
+	}
+
+	if len(res.Phases) > 0 {
+		rep.Phases = res.Phases
+		rep.phaseEnter = res.PhaseEnter
+		rep.phaseDone = res.PhaseDone
+	}
+	rep.TestCoverageAvailable = res.TestCoverageAvailable
+	rep.TestCoveragePercentage = res.TestCoveragePercentage
+	rep.FunctionsWithoutTest = res.FunctionsWithoutTest
+	rep.FunctionsWithTest = res.FunctionsWithTest
+	rep.ResourceUsageAvailable = res.ResourceUsageAvailable
+	rep.PeakMemoryBytes = res.PeakMemoryBytes
+	rep.CPUTime = res.CPUTime
+	if res.Error != "" {
+		return xerrors.Errorf("build failed on worker %s: %s", worker, res.Error)
+	}
+
+	return wp.downloadArtifact(buildctx, p, worker, res)
+}
+
+func (wp *WorkerPool) downloadArtifact(buildctx *buildContext, p *Package, worker string, res *workerJobResult) error {
+	loc, _ := buildctx.LocalCache.Location(p)
+	if loc == "" {
+		return xerrors.Errorf("cannot determine cache location of %s", p.FullName())
+	}
+	dst := filepath.Join(filepath.Dir(loc), filepath.Base(res.Artifact))
+
+	resp, err := wp.client.Get(fmt.Sprintf("%s/v1/jobs/%s/artifact?name=%s", worker, res.JobID, filepath.Base(res.Artifact)))
+	if err != nil {
+		return xerrors.Errorf("cannot download build artifact of %s: %w", p.FullName(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("cannot download build artifact of %s: %s", p.FullName(), resp.Status)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		return xerrors.Errorf("cannot download build artifact of %s: %w", p.FullName(), err)
+	}
+	return os.Rename(f.Name(), dst)
+}
+
+// checkWorkerBuild returns an error if the package cannot be built on a worker because the worker bundle lacks what its build needs
+func checkWorkerBuild(p *Package) error {
+	if cfg, ok := p.Config.(GoPkgConfig); ok && cfg.Packaging == GoModCache && cfg.WorkspaceModules {
+		return xerrors.Errorf("%s cannot be built on workers: workspaceModules needs the go.mod files of the whole workspace, which workers do not receive", p.FullName())
+	}
+	if _, ok := p.C.W.Plugins[p.Type]; ok {
+		return xerrors.Errorf("%s cannot be built on workers: workers do not receive the %s builder plugin", p.FullName(), p.Type)
+	}
+	return nil
+}
+
+// newWorkerJob describes the build of a package for a worker
+func newWorkerJob(buildctx *buildContext, p *Package) (*workerJob, error) {
+	version, err := p.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	ws := p.C.W
+	job := &workerJob{
+		Package:            p.FullName(),
+		Version:            version,
+		Packages:           []string{p.FullName()},
+		Environment:        make(map[string]string, len(ws.EnvironmentManifest)),
+		Args:               ws.args,
+		DontTest:           buildctx.DontTest,
+		DontCompress:       buildctx.DontCompress,
+		JailedExecution:    buildctx.JailedExecution,
+		SandboxedExecution: buildctx.SandboxedExecution,
+	}
+	for _, dep := range p.GetTransitiveDependencies() {
+		job.Packages = append(job.Packages, dep.FullName())
+	}
+	var (
+		tpes = make(map[PackageType]struct{})
+		pms  = make(map[JSPackageManager]struct{})
+	)
+	for _, pkg := range ws.Packages {
+		tpes[pkg.Type] = struct{}{}
+		if pkg.Type == YarnPackage {
+			pms[pkg.JSPackageManager()] = struct{}{}
+		}
+	}
+	for tpe := range tpes {
+		job.PackageTypes = append(job.PackageTypes, tpe)
+	}
+	sort.Slice(job.PackageTypes, func(i, j int) bool { return job.PackageTypes[i] < job.PackageTypes[j] })
+	for pm := range pms {
+		job.JSPackageManagers = append(job.JSPackageManagers, pm)
+	}
+	sort.Slice(job.JSPackageManagers, func(i, j int) bool { return job.JSPackageManagers[i] < job.JSPackageManagers[j] })
+	for _, e := range ws.EnvironmentManifest {
+		job.Environment[e.Name] = e.Value
+	}
+	if vnt := ws.SelectedVariant; vnt != nil && vnt != ws.DefaultVariant {
+		job.Variant = vnt.Name
+	}
+
+	return job, nil
+}
+
+// writeWorkerBundle writes the job bundle: the job description, the parts of the workspace the package build needs,
+// and the build artifacts of all dependencies.
+func writeWorkerBundle(out io.Writer, buildctx *buildContext, p *Package, job *workerJob) (err error) {
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	defer func() {
+		if err != nil {
+			return
+		}
+		err = tw.Close()
+		if err != nil {
+			return
+		}
+		err = gz.Close()
+	}()
+
+	fc, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{Name: workerJobFile, Mode: 0644, Size: int64(len(fc)), ModTime: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(fc)
+	if err != nil {
+		return err
+	}
+
+	ws := p.C.W
+	files := make(map[string]struct{})
+	for _, fn := range []string{"WORKSPACE.yaml", "WORKSPACE.args.yaml", ".turbocacheignore"} {
+		fn = filepath.Join(ws.Origin, fn)
+		if _, err := os.Stat(fn); err == nil {
+			files[fn] = struct{}{}
+		}
+	}
+	pkgs := append([]*Package{p}, p.GetTransitiveDependencies()...)
+	comps := make(map[*Component]struct{})
+	for _, pkg := range pkgs {
+		comps[pkg.C] = struct{}{}
+	}
+	for comp := range comps {
+		// the worker loads all packages of the component, hence needs all their sources
+		for _, fn := range []string{"BUILD.yaml", "BUILD.js"} {
+			fn = filepath.Join(comp.Origin, fn)
+			if _, err := os.Stat(fn); err == nil {
+				files[fn] = struct{}{}
+			}
+		}
+		for _, pkg := range comp.Packages {
+			for _, src := range pkg.Sources {
+				files[src] = struct{}{}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for fn := range files {
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+	for _, fn := range names {
+		rel, err := filepath.Rel(ws.Origin, fn)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return xerrors.Errorf("cannot send %s to worker: file is outside the workspace", fn)
+		}
+		err = addFileToTar(tw, fn, filepath.Join(workerWorkspaceDir, rel))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dep := range p.GetTransitiveDependencies() {
+		fn, exists := buildctx.LocalCache.Location(dep)
+		if !exists {
+			return PkgNotBuiltErr{dep}
+		}
+		err = addFileToTar(tw, fn, filepath.Join(workerCacheDir, filepath.Base(fn)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addFileToTar(tw *tar.Writer, fn, name string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(name)
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// extractWorkerBundle extracts a job bundle to dst
+func extractWorkerBundle(in io.Reader, dst string) error {
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return xerrors.Errorf("unsupported entry %s: bundles must contain regular files only", hdr.Name)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return xerrors.Errorf("invalid entry %s: bundle entries must not leave the bundle", hdr.Name)
+		}
+		fn := filepath.Join(dst, name)
+		err = os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package turbocache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExtractWorkerBundle(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Files map[string]string
+		Error bool
+	}{
+		{Name: "regular files", Files: map[string]string{"job.json": "{}", "workspace/comp/BUILD.yaml": "packages: []"}},
+		{Name: "relative escape", Files: map[string]string{"../evil": "x"}, Error: true},
+		{Name: "nested escape", Files: map[string]string{"workspace/../../evil": "x"}, Error: true},
+		{Name: "absolute path", Files: map[string]string{"/tmp/evil": "x"}, Error: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			for name, content := range test.Files {
+				err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = tw.Write([]byte(content))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			tw.Close()
+			gz.Close()
+
+			dst := filepath.Join(t.TempDir(), "job")
+			err := extractWorkerBundle(&buf, dst)
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range test.Files {
+				fc, err := os.ReadFile(filepath.Join(dst, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(fc) != content {
+					t.Errorf("%s: expected %q, actual %q", name, content, string(fc))
+				}
+			}
+		})
+	}
+}
+
+func TestDiffEnvironmentManifest(t *testing.T) {
+	expected := map[string]string{"go": "go version go1.22.0 linux/amd64", "os": "linux"}
+	actual := EnvironmentManifest{
+		{Name: "go", Value: "go version go1.21.0 linux/amd64"},
+		{Name: "os", Value: "linux"},
+		{Name: "node", Value: "v20"},
+	}
+
+	act := diffEnvironmentManifest(expected, actual)
+	exp := []string{`go is "go version go1.21.0 linux/amd64" instead of "go version go1.22.0 linux/amd64"`}
+	if diff := cmp.Diff(exp, act); diff != "" {
+		t.Errorf("diffEnvironmentManifest() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCheckWorkerBuild(t *testing.T) {
+	ws := &Workspace{Plugins: map[PackageType]*BuilderPlugin{"bazel": {Command: []string{"bazel-plugin"}}}}
+	tests := []struct {
+		Name   string
+		Type   PackageType
+		Config PackageConfig
+		Error  bool
+	}{
+		{Name: "go app", Type: GoPackage, Config: GoPkgConfig{Packaging: GoApp}},
+		{Name: "modcache", Type: GoPackage, Config: GoPkgConfig{Packaging: GoModCache}},
+		{Name: "modcache with workspace modules", Type: GoPackage, Config: GoPkgConfig{Packaging: GoModCache, WorkspaceModules: true}, Error: true},
+		{Name: "plugin", Type: "bazel", Config: PluginPkgConfig{}, Error: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			pkg := &Package{
+				C:               &Component{W: ws, Name: "comp"},
+				PackageInternal: PackageInternal{Name: "pkg", Type: test.Type},
+				Config:          test.Config,
+			}
+			err := checkWorkerBuild(pkg)
+			if test.Error && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.Error && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -39,6 +39,11 @@ type Workspace struct {
 	Variants            []*PackageVariant   `yaml:"variants,omitempty"`
 	EnvironmentManifest EnvironmentManifest `yaml:"environmentManifest,omitempty"`
 	Provenance          WorkspaceProvenance `yaml:"provenance,omitempty"`
+	Hermetic            WorkspaceHermetic   `yaml:"hermetic,omitempty"`
+	JavaScript          WorkspaceJavaScript `yaml:"javascript,omitempty"`
+	Docker              WorkspaceDocker     `yaml:"docker,omitempty"`
+	// Plugins are the builder plugins which provide additional package types
+	Plugins map[PackageType]*BuilderPlugin `yaml:"plugins,omitempty"`
 
 	Origin          string                `yaml:"-"`
 	Components      map[string]*Component `yaml:"-"`
@@ -48,6 +53,7 @@ type Workspace struct {
 	Git             GitInfo               `yaml:"-"`
 
 	ignores []string
+	args    Arguments
 }
 
 type WorkspaceProvenance struct {
@@ -58,6 +64,58 @@ type WorkspaceProvenance struct {
 	key     *in_toto.Key `yaml:"-"`
 }
 
+// WorkspaceHermetic configures which host environment variables reach package builds
+type WorkspaceHermetic struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PassEnv lists the host environment variables passed through to build commands.
+	// Entries can be shell patterns, e.g. LC_*.
+	PassEnv []string `yaml:"passEnv,omitempty"`
+	// HashPassEnv adds the values of all passed-through variables to the version manifest
+	HashPassEnv bool `yaml:"hashPassEnv,omitempty"`
+}
+
+// WorkspaceJavaScript configures how yarn packages are built
+type WorkspaceJavaScript struct {
+	// PackageManager is used for all yarn packages which do not configure a package manager themselves
+	PackageManager JSPackageManager `yaml:"packageManager,omitempty"`
+}
+
+// WorkspaceDocker configures how docker packages are built
+type WorkspaceDocker struct {
+	// Builder is the tool which builds the images of all docker packages. Defaults to docker.
+	Builder DockerBuilder `yaml:"builder,omitempty"`
+}
+
+// FilterEnvironment returns the host environment variables (KEY=VALUE) which may reach a build.
+// If hermetic mode is disabled, the environment is returned unchanged.
+func (h WorkspaceHermetic) FilterEnvironment(environ []string) []string {
+	if !h.Enabled {
+		return environ
+	}
+
+	res := make([]string, 0, len(h.PassEnv))
+	for _, kv := range environ {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if h.passes(name) {
+			res = append(res, kv)
+		}
+	}
+	return res
+}
+
+func (h WorkspaceHermetic) passes(name string) bool {
+	for _, ptn := range h.PassEnv {
+		if ptn == name {
+			return true
+		}
+		if ok, _ := filepath.Match(ptn, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func DiscoverWorkspaceRoot() (string, error) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -155,12 +213,31 @@ var defaultEnvManifestEntries = map[PackageType]EnvironmentManifest{
 	GoPackage: []EnvironmentManifestEntry{
 		{Name: "go", Command: []string{"go", "version"}},
 	},
+	RustPackage: []EnvironmentManifestEntry{
+		{Name: "cargo", Command: []string{"cargo", "--version"}},
+		{Name: "rustc", Command: []string{"rustc", "--version"}},
+	},
+	PythonPackage: []EnvironmentManifestEntry{
+		{Name: "python", Command: []string{"python3", "--version"}},
+	},
 	YarnPackage: []EnvironmentManifestEntry{
-		{Name: "yarn", Command: []string{"yarn", "-v"}},
 		{Name: "node", Command: []string{"node", "--version"}},
 	},
 }
 
+// defaultJSPackageManagerEnvManifestEntries are added to the environment manifest for each package manager used by yarn packages
+var defaultJSPackageManagerEnvManifestEntries = map[JSPackageManager]EnvironmentManifest{
+	JSPackageManagerYarn: []EnvironmentManifestEntry{
+		{Name: "yarn", Command: []string{"yarn", "-v"}},
+	},
+	JSPackageManagerPNPM: []EnvironmentManifestEntry{
+		{Name: "pnpm", Command: []string{"pnpm", "--version"}},
+	},
+	JSPackageManagerNPM: []EnvironmentManifestEntry{
+		{Name: "npm", Command: []string{"npm", "--version"}},
+	},
+}
+
 // ShouldIgnoreComponent returns true if a file should be ignored for a component listing
 func (ws *Workspace) ShouldIgnoreComponent(path string) bool {
 	return ws.ShouldIgnoreSource(path)
@@ -193,6 +270,10 @@ func loadWorkspaceYAML(path string) (Workspace, error) {
 	if err != nil {
 		return Workspace{}, err
 	}
+	err = validatePlugins(workspace.Plugins)
+	if err != nil {
+		return Workspace{}, err
+	}
 	return workspace, nil
 }
 
@@ -200,6 +281,15 @@ type loadWorkspaceOpts struct {
 	PrelinkModifier   func(map[string]*Package)
 	ArgumentDefaults  map[string]string
 	ProvenanceKeyPath string
+
+	// Packages limits the workspace to the listed packages. All other packages and all scripts are dropped before linking.
+	// Workers use this to load the partial workspace they receive with a build job.
+	Packages []string
+	// PackageTypes are considered used in addition to the types of the packages in the workspace when computing the environment manifest
+	PackageTypes []PackageType
+	// JSPackageManagers are considered used in addition to the package managers of the yarn packages in the workspace
+	// when computing the environment manifest
+	JSPackageManagers []JSPackageManager
 }
 
 func loadWorkspace(ctx context.Context, path string, args Arguments, variant string, opts *loadWorkspaceOpts) (Workspace, error) {
@@ -287,6 +377,7 @@ func loadWorkspace(ctx context.Context, path string, args Arguments, variant str
 
 		args[key] = val
 	}
+	workspace.args = args
 
 	comps, err := discoverComponents(ctx, &workspace, args, workspace.SelectedVariant, opts)
 	if err != nil {
@@ -295,22 +386,46 @@ func loadWorkspace(ctx context.Context, path string, args Arguments, variant str
 	workspace.Components = make(map[string]*Component)
 	workspace.Packages = make(map[string]*Package)
 	workspace.Scripts = make(map[string]*Script)
-	packageTypesUsed := make(map[PackageType]struct{})
+	var (
+		packageTypesUsed      = make(map[PackageType]struct{})
+		jsPackageManagersUsed = make(map[JSPackageManager]struct{})
+	)
 	for _, comp := range comps {
 		workspace.Components[comp.Name] = comp
 
 		for _, pkg := range comp.Packages {
+			if _, isPlugin := workspace.Plugins[pkg.Type]; !isBuiltinPackageType(pkg.Type) && !isPlugin {
+				return Workspace{}, xerrors.Errorf("%s: unknown package type \"%s\" - register a builder plugin for it in WORKSPACE.yaml", pkg.FullName(), pkg.Type)
+			}
 			workspace.Packages[pkg.FullName()] = pkg
 			packageTypesUsed[pkg.Type] = struct{}{}
+			if pkg.Type == YarnPackage {
+				jsPackageManagersUsed[pkg.JSPackageManager()] = struct{}{}
+			}
 		}
 		for _, script := range comp.Scripts {
 			workspace.Scripts[script.FullName()] = script
 		}
 	}
 
+	if opts != nil {
+		for _, tpe := range opts.PackageTypes {
+			packageTypesUsed[tpe] = struct{}{}
+		}
+		for _, pm := range opts.JSPackageManagers {
+			jsPackageManagersUsed[pm] = struct{}{}
+		}
+	}
+
+	// plugins contribute to the sources of their packages and to the env manifest
+	err = loadPlugins(&workspace, packageTypesUsed)
+	if err != nil {
+		return Workspace{}, err
+	}
+
 	// with all packages loaded we can compute the env manifest, becuase now we know which package types are actually
 	// used, hence know the default env manifest entries.
-	workspace.EnvironmentManifest, err = buildEnvironmentManifest(workspace.EnvironmentManifest, packageTypesUsed)
+	workspace.EnvironmentManifest, err = buildEnvironmentManifest(workspace.EnvironmentManifest, packageTypesUsed, jsPackageManagersUsed, workspace.Plugins)
 	if err != nil {
 		return Workspace{}, err
 	}
@@ -325,10 +440,36 @@ func loadWorkspace(ctx context.Context, path string, args Arguments, variant str
 		workspace.Git = *gitnfo
 	}
 
+	// modcache packages for the whole workspace must see all Go modules, even if we limit the workspace below
+	var goModuleFiles []string
+	for _, pkg := range workspace.Packages {
+		cfg, ok := pkg.Config.(GoPkgConfig)
+		if !ok || !cfg.WorkspaceModules {
+			continue
+		}
+		if goModuleFiles == nil {
+			goModuleFiles = workspaceGoModuleFiles(workspace.Packages)
+		}
+		pkg.goModuleFiles = goModuleFiles
+	}
+
+	if opts != nil && len(opts.Packages) > 0 {
+		limitWorkspace(&workspace, opts.Packages)
+	}
+
 	// now that we have all components/packages, we can link things
 	if opts != nil && opts.PrelinkModifier != nil {
 		opts.PrelinkModifier(workspace.Packages)
 	}
+	for _, pkg := range workspace.Packages {
+		if len(pkg.NamedOutputs) == 0 {
+			continue
+		}
+		pkg.namedOutputs = make(map[string]*Package, len(pkg.NamedOutputs))
+		for name := range pkg.NamedOutputs {
+			pkg.namedOutputs[name] = newNamedOutputPackage(pkg, name)
+		}
+	}
 	for _, pkg := range workspace.Packages {
 		err := pkg.link(workspace.Packages)
 		if err != nil {
@@ -384,8 +525,37 @@ func loadWorkspace(ctx context.Context, path string, args Arguments, variant str
 	return workspace, nil
 }
 
+// limitWorkspace drops all packages but the listed ones, as well as all scripts from the workspace
+func limitWorkspace(workspace *Workspace, pkgs []string) {
+	keep := make(map[string]struct{}, len(pkgs))
+	for _, p := range pkgs {
+		keep[p] = struct{}{}
+		// named outputs need the package they belong to
+		if owner, _, found := strings.Cut(p, "#"); found {
+			keep[owner] = struct{}{}
+		}
+	}
+
+	for name := range workspace.Packages {
+		if _, ok := keep[name]; !ok {
+			delete(workspace.Packages, name)
+		}
+	}
+	for _, comp := range workspace.Components {
+		var res []*Package
+		for _, p := range comp.Packages {
+			if _, ok := keep[p.FullName()]; ok {
+				res = append(res, p)
+			}
+		}
+		comp.Packages = res
+		comp.Scripts = nil
+	}
+	workspace.Scripts = make(map[string]*Script)
+}
+
 // buildEnvironmentManifest executes the commands of an env manifest and updates the values
-func buildEnvironmentManifest(entries EnvironmentManifest, pkgtpes map[PackageType]struct{}) (res EnvironmentManifest, err error) {
+func buildEnvironmentManifest(entries EnvironmentManifest, pkgtpes map[PackageType]struct{}, jspms map[JSPackageManager]struct{}, plugins map[PackageType]*BuilderPlugin) (res EnvironmentManifest, err error) {
 	t0 := time.Now()
 
 	envmf := make(map[string]EnvironmentManifestEntry, len(entries))
@@ -396,6 +566,16 @@ func buildEnvironmentManifest(entries EnvironmentManifest, pkgtpes map[PackageTy
 		for _, e := range defaultEnvManifestEntries[tpe] {
 			envmf[e.Name] = e
 		}
+		if pl, ok := plugins[tpe]; ok {
+			for _, e := range pl.environmentManifest {
+				envmf[e.Name] = e
+			}
+		}
+	}
+	for pm := range jspms {
+		for _, e := range defaultJSPackageManagerEnvManifestEntries[pm] {
+			envmf[e.Name] = e
+		}
 	}
 	for _, e := range entries {
 		e := e
@@ -535,6 +715,10 @@ func loadComponent(ctx context.Context, workspace *Workspace, path string, args
 	if err != nil {
 		return Component{}, err
 	}
+	fc, err = expandPackageMatrices(fc)
+	if err != nil {
+		return Component{}, err
+	}
 
 	// we attempt to load the constants of a component first so that we can add it to the args
 	var compconst struct {
@@ -780,6 +964,28 @@ func mergeConfig(pkg *Package, src PackageConfig) error {
 			return err
 		}
 		pkg.Config = dst
+	case RustPkgConfig:
+		dst := pkg.Config.(RustPkgConfig)
+		in, ok := src.(RustPkgConfig)
+		if !ok {
+			return xerrors.Errorf("cannot merge %s onto %s", reflect.TypeOf(src).String(), reflect.TypeOf(dst).String())
+		}
+		err := mergo.Merge(&dst, in)
+		if err != nil {
+			return err
+		}
+		pkg.Config = dst
+	case PythonPkgConfig:
+		dst := pkg.Config.(PythonPkgConfig)
+		in, ok := src.(PythonPkgConfig)
+		if !ok {
+			return xerrors.Errorf("cannot merge %s onto %s", reflect.TypeOf(src).String(), reflect.TypeOf(dst).String())
+		}
+		err := mergo.Merge(&dst, in)
+		if err != nil {
+			return err
+		}
+		pkg.Config = dst
 	case DockerPkgConfig:
 		dst := pkg.Config.(DockerPkgConfig)
 		in, ok := src.(DockerPkgConfig)
@@ -802,6 +1008,17 @@ func mergeConfig(pkg *Package, src PackageConfig) error {
 			return err
 		}
 		pkg.Config = dst
+	case PluginPkgConfig:
+		dst := pkg.Config.(PluginPkgConfig)
+		in, ok := src.(PluginPkgConfig)
+		if !ok {
+			return xerrors.Errorf("cannot merge %s onto %s", reflect.TypeOf(src).String(), reflect.TypeOf(dst).String())
+		}
+		err := mergo.Merge(&dst, in)
+		if err != nil {
+			return err
+		}
+		pkg.Config = dst
 	default:
 		return xerrors.Errorf("unknown config type %s", reflect.ValueOf(pkg.Config).Elem().Type().String())
 	}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/khulnasoft/turbocache/pkg/testutil"
 	"github.com/khulnasoft/turbocache/pkg/turbocache"
 )
@@ -80,6 +82,85 @@ func TestFixtureLoadWorkspace(t *testing.T) {
 			ExitCode:    0,
 			FixturePath: "fixtures/load-workspace.yaml",
 		},
+		{
+			Name:              "builder plugin",
+			T:                 t,
+			Args:              []string{"describe", "environment-manifest"},
+			NoNestedWorkspace: true,
+			ExitCode:          0,
+			StdoutSubs:        []string{"bazel: 7.1.0"},
+			Fixture: &testutil.Setup{
+				Workspace: turbocache.Workspace{
+					Plugins: map[turbocache.PackageType]*turbocache.BuilderPlugin{
+						"bazel": {Command: []string{"sh", "-c", `echo '{"version":"1","environmentManifest":[{"name":"bazel","command":["echo","7.1.0"]}]}'`}},
+					},
+				},
+				Components: []testutil.Component{
+					{
+						Location: "comp",
+						Packages: []turbocache.Package{
+							{
+								PackageInternal: turbocache.PackageInternal{
+									Name: "pkg",
+									Type: "bazel",
+								},
+								Config: turbocache.PluginPkgConfig{"target": "//foo"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:              "package matrix",
+			T:                 t,
+			Args:              []string{"collect"},
+			NoNestedWorkspace: true,
+			ExitCode:          0,
+			StdoutSubs:        []string{"comp:app-amd64-ee", "comp:app-amd64-oss", "comp:app-arm64-ee", "comp:app-arm64-oss", "comp:dist"},
+			Fixture: &testutil.Setup{
+				Files: map[string]string{
+					"comp/BUILD.yaml": `packages:
+- name: app
+  type: generic
+  matrix:
+    arch: [amd64, arm64]
+    flavor: [oss, ee]
+  config:
+    commands: [["echo", "${arch}", "${flavor}"]]
+- name: dist
+  type: generic
+  deps:
+  - :app-amd64-oss
+  - :app-arm64-ee
+`,
+				},
+			},
+		},
+		{
+			Name:              "unknown package type",
+			T:                 t,
+			Args:              []string{"collect"},
+			NoNestedWorkspace: true,
+			ExitCode:          1,
+			StderrSub:         "unknown package type",
+			Fixture: &testutil.Setup{
+				Components: []testutil.Component{
+					{
+						Location: "comp",
+						Packages: []turbocache.Package{
+							{
+								PackageInternal: turbocache.PackageInternal{
+									Name: "pkg",
+									Type: "bazel",
+								},
+								Config: turbocache.PluginPkgConfig{},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -312,3 +393,38 @@ func TestPackageDefinition(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkspaceHermeticFilterEnvironment(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "HOME=/root", "GOFLAGS=-mod=vendor", "LC_ALL=C", "LC_CTYPE=UTF-8", "AWS_SECRET_ACCESS_KEY=foo"}
+
+	tests := []struct {
+		Name        string
+		Hermetic    turbocache.WorkspaceHermetic
+		Expectation []string
+	}{
+		{
+			Name:        "disabled",
+			Hermetic:    turbocache.WorkspaceHermetic{PassEnv: []string{"PATH"}},
+			Expectation: environ,
+		},
+		{
+			Name:        "empty allowlist",
+			Hermetic:    turbocache.WorkspaceHermetic{Enabled: true},
+			Expectation: []string{},
+		},
+		{
+			Name:        "names and patterns",
+			Hermetic:    turbocache.WorkspaceHermetic{Enabled: true, PassEnv: []string{"PATH", "HOME", "LC_*"}},
+			Expectation: []string{"PATH=/usr/bin", "HOME=/root", "LC_ALL=C", "LC_CTYPE=UTF-8"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := test.Hermetic.FilterEnvironment(environ)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("FilterEnvironment() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}